@@ -6,6 +6,7 @@ import (
 	"flag"
 	"fmt"
 	. "github.com/chrissexton/kakapo/lisp"
+	_ "github.com/chrissexton/kakapo/stdlib"
 	"os"
 	"strings"
 )
@@ -13,7 +14,11 @@ import (
 const VERSION = `0.5`
 
 var (
-	version = flag.Bool("V", false, "Display version information and exit")
+	version  = flag.Bool("V", false, "Display version information and exit")
+	goErrors = flag.Bool("E", false,
+		"Panic when a Go function returns a non-nil error")
+	expand = flag.Bool("expand", false,
+		"Print the given files with their macros expanded instead of running them")
 )
 
 func main() {
@@ -24,31 +29,42 @@ func main() {
 		return
 	}
 
-	// Expose imports
-	for name, pkg := range _go_imports {
-		ExposeImport(name, pkg)
-	}
+	PanicOnGoError(*goErrors)
 
 	// Expose globals
 	ExposeGlobal("-interpreter", "Kakapo")
 	ExposeGlobal("-interpreter-version", VERSION)
 
 	args := flag.Args()
+	if *expand {
+		for _, path := range args {
+			check(ExpandFile(path, os.Stdout))
+		}
+		return
+	}
 	if len(args) == 0 {
 		// Start the read-eval-print loop (repl.lisp)
-		EvalFrom(strings.NewReader(repl))
+		check(EvalFrom(strings.NewReader(repl)))
 	} else {
 		for _, path := range args {
 			if path == "-" {
-				EvalFrom(os.Stdin)
+				check(EvalFrom(os.Stdin))
 			} else {
-				file, err := os.Open(path)
-				if err != nil {
-					fmt.Fprintln(os.Stderr, err)
-					os.Exit(1)
-				}
-				EvalFrom(file)
+				check(EvalFile(path))
 			}
 		}
 	}
 }
+
+// check reports err, along with its Lisp backtrace if it has one, and exits
+// if it is not nil.
+func check(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if e, ok := err.(*Error); ok && len(e.Backtrace) > 0 {
+			fmt.Fprintln(os.Stderr, "Backtrace:")
+			fmt.Fprintln(os.Stderr, e.BacktraceString())
+		}
+		os.Exit(1)
+	}
+}
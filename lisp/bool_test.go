@@ -6,7 +6,10 @@ func TestTrue(t *testing.T) {
 	trueVals := []string{"1", "2", "(not nil)", "(not (not (not nil)))",
 			  "true", "(not false)"}
 	for _, v := range(trueVals) {
-		if !IsTrue(EvalStr(v)) {
+		r, err := EvalStr(v)
+		if err != nil {
+			t.Error(v, "failed:", err)
+		} else if !IsTrue(r) {
 			t.Error(v, "did not evaluate to truth.")
 		}
 	}
@@ -15,9 +18,11 @@ func TestTrue(t *testing.T) {
 func testFalse(t *testing.T) {
 	falseVals := []string{"false", "(not true)"}
 	for _, v := range(falseVals) {
-		if IsTrue(EvalStr(v)) {
+		r, err := EvalStr(v)
+		if err != nil {
+			t.Error(v, "failed:", err)
+		} else if IsTrue(r) {
 			t.Error(v, "did not evaluate to falsehood.")
 		}
 	}
 }
-
@@ -7,18 +7,23 @@ import (
 	"reflect"
 )
 
-// Circumvent lame initialization loop detection. An explicit init() allows
-// builtinDefine et al to reference global.
-func init() {
-	globalData := map[sym]sexpr{
+// builtinData returns a fresh table of the builtin bindings that make up the
+// core namespace of an Interpreter.
+func builtinData() map[sym]sexpr {
+	return map[sym]sexpr{
 		// Misc. primitives (primitives.go)
-		"if":     primitive("if", primitiveIf),
+		"if":     tailPrimitive("if", primitiveIf),
 		"for":    primitive("for", primitiveFor),
 		"lambda": primitive("lambda", primitiveLambda),
-		"let":    primitive("let", primitiveLet),
+		"let":    tailPrimitive("let", primitiveLet),
 		"define": primitive("define", primitiveDefine),
 		"quote":  primitive("quote", primitiveQuote),
-		"begin":  primitive("begin", primitiveBegin),
+		"begin":  tailPrimitive("begin", primitiveBegin),
+
+		// Quasiquotation (quasiquote.go)
+		"quasiquote":       primitive("quasiquote", primitiveQuasiquote),
+		"unquote":          primitive("unquote", primitiveUnquote),
+		"unquote-splicing": primitive("unquote-splicing", primitiveUnquoteSplicing),
 
 		// Nil
 		"nil": Nil,
@@ -37,6 +42,32 @@ func init() {
 		"list": function(builtinList),
 		"list?": function(builtinIsList),
 
+		// Maps (hashmap.go)
+		"make-map":     function(builtinMakeMap),
+		"map?":         function(builtinIsMap),
+		"map-get":      function(builtinMapGet),
+		"map-set!":     function(builtinMapSet),
+		"map-delete!":  function(builtinMapDelete),
+		"map-count":    function(builtinMapCount),
+		"map-keys":     function(builtinMapKeys),
+		"map-for-each": function(builtinMapForEach),
+
+		// Vectors (vector.go)
+		"vector":        function(builtinVector),
+		"vector?":       function(builtinIsVector),
+		"vector-ref":    function(builtinVectorRef),
+		"vector-set!":   function(builtinVectorSet),
+		"vector-length": function(builtinVectorLength),
+		"vector-append": function(builtinVectorAppend),
+		"vector-slice":  function(builtinVectorSlice),
+		"vector->list":  function(builtinVectorToList),
+		"list->vector":  function(builtinListToVector),
+
+		// Multiple values (values.go)
+		"values":              function(builtinValues),
+		"call-with-values":    function(builtinCallWithValues),
+		"multiple-value-bind": tailPrimitive("multiple-value-bind", primitiveMultipleValueBind),
+
 		// Basic stuff
 		"equal?": function(builtinEqual),
 
@@ -58,27 +89,45 @@ func init() {
 		"/":  function(builtinDiv),
 		"%":  function(builtinMod),
 
+		// Go types (gotype.go)
+		"field":      function(builtinField),
+		"set-field!": function(builtinSetField),
+		"new":        function(builtinNew),
+		"make":       function(builtinMake),
+
 		// Go runtime (compat.go)
-		//"import": function(builtinImport),
+		"import": primitive("import", primitiveImport),
+
+		// Namespaces (namespace.go)
+		"in-ns":      function(builtinInNs),
+		"current-ns": function(builtinCurrentNs),
+		"ns-publics": function(builtinNsPublics),
+		"ns-resolve": function(builtinNsResolve),
+
+		// Modules (module.go)
+		"require": primitive("require", primitiveRequire),
+		"provide": primitive("provide", primitiveProvide),
 
 		// Panics (panic.go)
 		"recover": function(builtinRecover),
 		"panic":   function(builtinPanic),
+		"backtrace": function(builtinBacktrace),
 
 		// Concurrency
 		"chan": function(builtinMakeChan),
 		"go": primitive("go", primitiveGo),
 		"<-": function(builtinLeftArrow),
 
-		// Macros
+		// Macros (macro.go, syntax.go, expand.go)
 		"defmacro": primitive("defmacro", primitiveDefmacro),
-		"macroexpand1": primitive("macroexpand1", primitiveMacroexpand1),
+		"macroexpand-1": function(builtinMacroexpand1),
+		"macroexpand1": function(builtinMacroexpand1),
+		"macroexpand": function(builtinMacroexpand),
+		"macroexpand-all": function(builtinMacroexpandAll),
+		"gensym": function(builtinGensym),
+		"syntax-rules": primitive("syntax-rules", primitiveSyntaxRules),
+		"define-syntax": primitive("define-syntax", primitiveDefineSyntax),
 	}
-
-	global = &scope{globalData, nil}
-
-	// Now interpret init_lisp
-	load(init_lisp)
 }
 
 // (list? expr)
@@ -144,14 +193,18 @@ func builtinRead(sc *scope, ss []sexpr) sexpr {
 	return v
 }
 
-// (eval expr)
+// (eval expr [ns])
 //
-// Evaluates an s-expression.
+// Evaluates an s-expression, at the top level of the namespace ns if one is
+// given.
 func builtinEval(sc *scope, ss []sexpr) sexpr {
+	if len(ss) == 2 {
+		return eval(sc.interp.namespaceArg(ss[1]).sc, ss[0])
+	}
 	if len(ss) != 1 {
 		panic("Invalid number of arguments")
 	}
-	return eval(sc, ss[0]) // TODO custom scope
+	return eval(sc, ss[0])
 }
 
 // (print expr)
@@ -199,13 +252,35 @@ func builtinEq(sc *scope, ss []sexpr) sexpr {
 		return true
 	}
 	for _, e := range(ss[1:len(ss)]) {
-		if !reflect.DeepEqual(ss[0], e) {
+		if !equal(ss[0], e) {
 			return Nil
 		}
 	}
 	return true
 }
 
+// equal reports whether a and b are structurally equal. Source positions are
+// not taken into account, and numbers are compared by value.
+func equal(a, b sexpr) bool {
+	if isNumber(a) && isNumber(b) {
+		return numCompare(a, b) == 0
+	}
+	if am, ok := a.(*hashMap); ok {
+		bm, ok := b.(*hashMap)
+		return ok && am.equal(bm)
+	}
+	if av, ok := a.(*vector); ok {
+		bv, ok := b.(*vector)
+		return ok && av.equal(bv)
+	}
+	ac, ok := a.(cons)
+	if !ok {
+		return reflect.DeepEqual(a, b)
+	}
+	bc, ok := b.(cons)
+	return ok && equal(ac.car, bc.car) && equal(ac.cdr, bc.cdr)
+}
+
 // (/= ...)
 //
 // Returns true if not all arguments are equal.
@@ -1,97 +1,232 @@
 package lisp
 
 import (
+	"errors"
 	"fmt"
+	"math/big"
 	"path"
 	"reflect"
+	"sort"
+	"strconv"
+	"strings"
 )
 
-// The map of available imports
-var _go_imports = map[string]map[string]interface{}{}
-
+// Make a package available to the default interpreter.
 func ExposeImport(name string, pkg map[string]interface{}) {
-	_go_imports[name] = pkg
+	defaultInterpreter.Import(name, pkg)
 }
 
-// Expose an identifier globally.
+// Expose an identifier globally in the default interpreter.
 func ExposeGlobal(id string, x interface{}) {
-	global.define(sym(id), wrapGo(x))
+	defaultInterpreter.Define(id, x)
+}
+
+// Set whether Go errors panic in the default interpreter; see
+// Interpreter.PanicOnGoError.
+func PanicOnGoError(on bool) {
+	defaultInterpreter.PanicOnGoError(on)
 }
 
-func builtinImport(sc *scope, ss []sexpr) sexpr {
-	if len(ss) != 1 {
+// (import "path" [:as name] [Name...])
+//
+// Defines the identifiers of the Go package with the given import path, as
+// define does, under the names name.Identifier. name defaults to the last
+// element of the path. When Names are given, only those identifiers are
+// imported. The methods of an imported type are defined as
+// name.Type.Method. The identifiers are also defined in the namespace name,
+// so that they can be referred to as name/Identifier.
+func primitiveImport(sc *scope, ss []sexpr) sexpr {
+	if len(ss) == 0 {
 		panic("Invalid number of arguments")
 	}
-
-	pkgPath, ok := ss[0].(string)
+	pkgPath, ok := eval(sc, ss[0]).(string)
 	if !ok {
 		panic("Invalid argument")
 	}
+	pkgName := packageName(pkgPath)
+	var names []string
+	for i := 1; i < len(ss); i++ {
+		switch s := ss[i].(type) {
+		case keyword:
+			if s != "as" || i+1 == len(ss) {
+				panic(fmt.Sprintf("Invalid import option %s", asString(s)))
+			}
+			i++
+			alias, ok := ss[i].(sym)
+			if !ok {
+				panic("Invalid argument")
+			}
+			pkgName = string(alias)
+		case sym:
+			names = append(names, string(s))
+		default:
+			panic("Invalid argument")
+		}
+	}
 
-	pkgName := path.Base(pkgPath)
-
-	// find the package in _go_imports
-	pkg, found := _go_imports[pkgPath]
+	// find the package in the interpreter's imports or the registry
+	pkg, found := sc.interp.lookupPackage(pkgPath)
 	if !found {
-		panic("Package not found")
+		panic(fmt.Sprintf("Package not found: %q%s", pkgPath,
+			suggest(pkgPath, sc.interp.packagePaths())))
+	}
+
+	if names != nil {
+		selected := make(map[string]interface{}, len(names))
+		for _, name := range names {
+			if _go, ok := pkg[name]; ok {
+				selected[name] = _go
+			} else if _go, ok := pkg["\x00"+name]; ok {
+				selected["\x00"+name] = _go
+			} else {
+				panic(fmt.Sprintf("%s has no identifier %s%s", pkgPath, name,
+					suggest(name, identifiers(pkg))))
+			}
+		}
+		pkg = selected
 	}
 
 	// import each item
+	defs := make(map[sym]sexpr)
 	for name, _go := range pkg {
 		if name[0] != '\x00' {
-			sc.define(sym(pkgName+"."+name), wrapGo(_go))
+			defs[sym(name)] = wrapGo(_go)
 		} else {
+			t := _go.(reflect.Type)
+			defs[sym(name[1:])] = goType{t}
 			// import all methods on this object
-			importMethods(sc, pkgName, name[1:], _go)
+			importMethods(defs, name[1:], t)
 			// and for the pointer version as well
-			t := _go.(reflect.Type)
-			importMethods(sc, pkgName, name[1:], reflect.PtrTo(t))
+			importMethods(defs, name[1:], reflect.PtrTo(t))
 		}
 	}
+	ns := sc.interp.namespace(sym(pkgName))
+	for name, v := range defs {
+		sc.defineHigh(sym(pkgName)+"."+name, v)
+		ns.sc.define(name, v)
+	}
 	return Nil
 }
 
-func importMethods(sc *scope, pkgName, name string, r interface{}) {
-	t := r.(reflect.Type)
+// packageName returns the name a package is imported as by default: the
+// last element of its import path, or the one before it if that is a major
+// version such as v2.
+func packageName(pkgPath string) string {
+	elems := strings.Split(pkgPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' &&
+		strings.Trim(name[1:], "0123456789") == "" {
+		name = elems[len(elems)-2]
+	}
+	return name
+}
+
+// packagePaths returns the import paths of the packages that in can import.
+func (in *Interpreter) packagePaths() []string {
+	paths := RegisteredPackages()
+	for name := range in.imports {
+		paths = append(paths, name)
+	}
+	return paths
+}
+
+// identifiers returns the names of the identifiers of pkg.
+func identifiers(pkg map[string]interface{}) []string {
+	var names []string
+	for name := range pkg {
+		names = append(names, strings.TrimPrefix(name, "\x00"))
+	}
+	return names
+}
+
+// suggest returns a note listing the candidates that name may be a misspelling
+// of, to be added to an error message, or "" if there are none.
+func suggest(name string, candidates []string) string {
+	type match struct {
+		s    string
+		dist int
+	}
+	var matches []match
+	seen := make(map[string]bool)
+	for _, c := range candidates {
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		d := editDistance(strings.ToLower(name), strings.ToLower(c))
+		if d <= len(name)/3+1 || path.Base(c) == path.Base(name) {
+			matches = append(matches, match{c, d})
+		}
+	}
+	if len(matches) == 0 {
+		return ""
+	}
+	best := matches[0].dist
+	for _, m := range matches {
+		best = min(best, m.dist)
+	}
+	close := matches[:0]
+	for _, m := range matches {
+		if m.dist == best || path.Base(m.s) == path.Base(name) {
+			close = append(close, m)
+		}
+	}
+	matches = close
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].dist != matches[j].dist {
+			return matches[i].dist < matches[j].dist
+		}
+		return matches[i].s < matches[j].s
+	})
+	if len(matches) > 3 {
+		matches = matches[:3]
+	}
+	quoted := make([]string, len(matches))
+	for i, m := range matches {
+		quoted[i] = strconv.Quote(m.s)
+	}
+	return "; did you mean " + strings.Join(quoted, " or ") + "?"
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// importMethods adds the methods of the type t, imported as name, to defs as
+// name.Method.
+func importMethods(defs map[sym]sexpr, name string, t reflect.Type) {
 	for i := 0; i < t.NumMethod(); i++ {
 		m := t.Method(i)
-		n := fmt.Sprintf("%s.%s.%s", pkgName, name, m.Name)
+		n := fmt.Sprintf("%s.%s", name, m.Name)
 		mName := m.Name
-		sc.define(sym(n), function(func(sc *scope, ss []sexpr) sexpr {
+		defs[sym(n)] = function(func(sc *scope, ss []sexpr) sexpr {
 			if len(ss) == 0 {
 				panic("Invalid number of arguments")
 			}
-			v := reflect.ValueOf(ss[0])
-			if v.Type() != t {
-				panic("Invalid argument")
-			}
-			fun := v.MethodByName(mName)
-			t := fun.Type()
-			ni := t.NumIn()
-			ss = ss[1:]
-			if ni != len(ss) && !t.IsVariadic() {
-				panic("Invalid number of arguments")
-			}
-
-			vs := make([]reflect.Value, len(ss))
-			for i, s := range ss {
-				// get argument type
-				var at reflect.Type
-				if t.IsVariadic() && i >= ni-1 {
-					st := t.In(ni - 1)
-					at = st.Elem()
-				} else {
-					at = t.In(i)
-				}
-				// TODO convert any cons and function arguments
-				vs[i] = forGo(s, at)
-			}
-			r := fun.Call(vs)
-			if len(r) == 0 {
-				return Nil
+			if ss[0] == nil || reflect.TypeOf(ss[0]) != t {
+				panic(&typeError{arg: 1, v: ss[0], typ: t})
 			}
-			return wrapGoval(r[0])
-		}))
+			v := reflect.ValueOf(ss[0])
+			return callGo(sc, v.MethodByName(mName), ss[1:], 2)
+		})
 	}
 }
 
@@ -101,60 +236,58 @@ func wrapGo(_go interface{}) sexpr {
 }
 
 func wrapGoval(r reflect.Value) sexpr {
+	if r.CanInterface() {
+		// Lisp values passed through Go come back as they were.
+		switch v := r.Interface().(type) {
+		case sym, keyword, cons, *vector, *hashMap, *multipleValues,
+			function, *lambda, primitive_t, macro, goType:
+			return v
+		}
+	}
 	typ := r.Type()
 	kind := typ.Kind()
 	switch kind {
 	case reflect.Bool:
-		b := r.Bool()
-		if b {
-			return float64(1)
-		} else {
-			return Nil
+		if r.Bool() {
+			return true
 		}
-	case reflect.Int:
-		return float64(r.Int())
-	case reflect.Int8:
-		return float64(r.Int())
-	case reflect.Int16:
-		return float64(r.Int())
-	case reflect.Int32:
-		return float64(r.Int())
-	case reflect.Int64:
-		return float64(r.Int())
-	case reflect.Uint:
-		return float64(r.Uint())
-	case reflect.Uint8:
-		return float64(r.Uint())
-	case reflect.Uint16:
-		return float64(r.Uint())
-	case reflect.Uint32:
-		return float64(r.Uint())
-	case reflect.Uint64:
-		return float64(r.Uint())
+		return Nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		return r.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64:
+		return normBig(new(big.Int).SetUint64(r.Uint()))
 	case reflect.Uintptr:
 		return native(r.Interface()) // TODO
-	case reflect.Float32:
-		return float64(r.Float())
-	case reflect.Float64:
-		return float64(r.Float())
-	case reflect.Complex64:
-		return native(r.Interface()) // TODO
-	case reflect.Complex128:
-		return native(r.Interface()) // TODO
-	case reflect.Array:
-		return native(r.Interface()) // TODO
+	case reflect.Float32, reflect.Float64:
+		return r.Float()
+	case reflect.Complex64, reflect.Complex128:
+		return r.Complex()
+	case reflect.Array, reflect.Slice:
+		items := make([]sexpr, r.Len())
+		for i := range items {
+			items[i] = wrapGoval(r.Index(i))
+		}
+		return &vector{items}
 	case reflect.Chan:
 		return native(r.Interface()) // TODO
 	case reflect.Func:
 		return wrapFunc(r.Interface())
 	case reflect.Interface:
-		return native(r.Interface()) // TODO
+		if r.IsNil() {
+			return Nil
+		}
+		return wrapGoval(r.Elem())
 	case reflect.Map:
-		return native(r.Interface()) // TODO
+		m := newHashMap()
+		iter := r.MapRange()
+		for iter.Next() {
+			m.set(wrapGoval(iter.Key()), wrapGoval(iter.Value()))
+		}
+		return m
 	case reflect.Ptr:
 		return native(r.Interface()) // TODO
-	case reflect.Slice:
-		return native(r.Interface()) // TODO
 	case reflect.String:
 		return r.String()
 	case reflect.Struct:
@@ -165,147 +298,363 @@ func wrapGoval(r reflect.Value) sexpr {
 	return Nil
 }
 
-func forGo(v sexpr, typ reflect.Type) reflect.Value {
+// A typeError reports a Lisp value that cannot be converted to a Go type.
+type typeError struct {
+	arg    int // the position of the value in a call, from 1, if known
+	v      sexpr
+	typ    reflect.Type
+	reason string
+}
+
+func (e *typeError) Error() string {
+	s := fmt.Sprintf("cannot use %s (%s) as %s", asString(e.v), typeName(e.v),
+		e.typ)
+	if e.reason != "" {
+		s += ": " + e.reason
+	}
+	if e.arg > 0 {
+		s = fmt.Sprintf("Argument %d: %s", e.arg, s)
+	}
+	return s
+}
+
+// mismatch panics with a typeError for v and typ.
+func mismatch(v sexpr, typ reflect.Type, reason string) {
+	panic(&typeError{v: v, typ: typ, reason: reason})
+}
+
+// typeName returns the name of the type of the Lisp value v for messages.
+func typeName(v sexpr) string {
+	switch v.(type) {
+	case nil:
+		return "nil"
+	case sym:
+		return "symbol"
+	case keyword:
+		return "keyword"
+	case cons:
+		return "list"
+	case int64, *big.Int:
+		return "integer"
+	case *big.Rat:
+		return "ratio"
+	case float64:
+		return "float"
+	case complex128:
+		return "complex"
+	case string:
+		return "string"
+	case *vector:
+		return "vector"
+	case *hashMap:
+		return "map"
+	case *multipleValues:
+		return "multiple values"
+	case function, *lambda:
+		return "function"
+	case primitive_t:
+		return "primitive"
+	case macro:
+		return "macro"
+	case goType:
+		return "type"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// forGo converts the Lisp value v to a Go value of type typ. Lisp functions
+// converted to Go funcs are called in sc. A value that cannot be converted
+// panics with a *typeError.
+func forGo(sc *scope, v sexpr, typ reflect.Type) reflect.Value {
 	kind := typ.Kind()
+	if v == nil {
+		switch kind {
+		case reflect.Chan, reflect.Func, reflect.Interface, reflect.Map,
+			reflect.Ptr, reflect.Slice, reflect.UnsafePointer:
+			return reflect.Zero(typ)
+		}
+	} else {
+		// Go values, such as those returned by other Go functions, are
+		// passed on as they are if they have a suitable type.
+		r := reflect.ValueOf(v)
+		if r.Type().AssignableTo(typ) {
+			return r.Convert(typ)
+		}
+		if r.Kind() == kind && !isBasic(kind) && r.Type().ConvertibleTo(typ) {
+			return r.Convert(typ)
+		}
+	}
+
 	switch kind {
 	case reflect.Bool:
-		return reflect.ValueOf(v != Nil)
-	case reflect.Int:
-		f, ok := v.(float64)
+		r := reflect.New(typ).Elem()
+		r.SetBool(IsTrue(v))
+		return r
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32,
+		reflect.Int64:
+		i, ok := v.(int64)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(int(f))
-	case reflect.Int8:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r := reflect.New(typ).Elem()
+		if r.OverflowInt(i) {
+			mismatch(v, typ, "overflows")
 		}
-		return reflect.ValueOf(int8(f))
-	case reflect.Int16:
-		f, ok := v.(float64)
+		r.SetInt(i)
+		return r
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Uint64, reflect.Uintptr:
+		u, ok := toUint64(v)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(int16(f))
-	case reflect.Int32:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r := reflect.New(typ).Elem()
+		if r.OverflowUint(u) {
+			mismatch(v, typ, "overflows")
 		}
-		return reflect.ValueOf(int32(f))
-	case reflect.Int64:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r.SetUint(u)
+		return r
+	case reflect.Float32, reflect.Float64:
+		if !isReal(v) {
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(int64(f))
-	case reflect.Uint:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r := reflect.New(typ).Elem()
+		r.SetFloat(toFloat(v))
+		return r
+	case reflect.Complex64, reflect.Complex128:
+		if !isNumber(v) {
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(uint(f))
-	case reflect.Uint8:
-		f, ok := v.(float64)
+		r := reflect.New(typ).Elem()
+		r.SetComplex(toComplex(v))
+		return r
+	case reflect.String:
+		s, ok := v.(string)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(uint8(f))
-	case reflect.Uint16:
-		f, ok := v.(float64)
+		r := reflect.New(typ).Elem()
+		r.SetString(s)
+		return r
+	case reflect.Array:
+		items, ok := sequenceItems(v)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(uint16(f))
-	case reflect.Uint32:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		if len(items) != typ.Len() {
+			mismatch(v, typ, fmt.Sprintf("length %d", len(items)))
 		}
-		return reflect.ValueOf(uint32(f))
-	case reflect.Uint64:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r := reflect.New(typ).Elem()
+		for i, x := range items {
+			r.Index(i).Set(forGo(sc, x, typ.Elem()))
 		}
-		return reflect.ValueOf(uint64(f))
-	case reflect.Uintptr:
-		panic("Invalid argument") // TODO
-	case reflect.Float32:
-		f, ok := v.(float64)
+		return r
+	case reflect.Slice:
+		items, ok := sequenceItems(v)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(float32(f))
-	case reflect.Float64:
-		f, ok := v.(float64)
-		if !ok {
-			panic("Invalid argument")
+		r := reflect.MakeSlice(typ, len(items), len(items))
+		for i, x := range items {
+			r.Index(i).Set(forGo(sc, x, typ.Elem()))
 		}
-		return reflect.ValueOf(f)
-	case reflect.Complex64:
-		panic("Invalid argument") // TODO
-	case reflect.Complex128:
-		panic("Invalid argument") // TODO
-	case reflect.Array:
-		panic("Invalid argument") // TODO
-	case reflect.Chan:
-		panic("Invalid argument") // TODO
-	case reflect.Func:
-		// a reflect.Func is expected of our sexpr
-		panic("Cannot do raw callbacks yet, sorry") // XXX TODO
-	case reflect.Interface:
-		// TODO do some checks
-		reflect.ValueOf(v)
+		return r
 	case reflect.Map:
-		panic("Invalid argument") // TODO
-	case reflect.Ptr:
-		panic("Invalid argument") // TODO
-	case reflect.Slice:
-		panic("Invalid argument") // TODO
-	case reflect.String:
-		s, ok := v.(string)
+		m, ok := v.(*hashMap)
 		if !ok {
-			panic("Invalid argument")
+			mismatch(v, typ, "")
+		}
+		r := reflect.MakeMapWithSize(typ, len(m.entries))
+		for _, e := range m.entries {
+			r.SetMapIndex(forGo(sc, e.key, typ.Key()),
+				forGo(sc, e.val, typ.Elem()))
+		}
+		return r
+	case reflect.Func:
+		if !isFunction(v) {
+			mismatch(v, typ, "")
 		}
-		return reflect.ValueOf(s)
+		return makeCallback(sc, v, typ)
+	case reflect.Interface:
+		mismatch(v, typ, missingMethod(reflect.TypeOf(v), typ))
 	case reflect.Struct:
-		panic("Invalid argument") // TODO
-	case reflect.UnsafePointer:
-		panic("Invalid argument") // can't handle this
+		// a pointer to a struct is dereferenced
+		r := reflect.ValueOf(v)
+		if r.Kind() == reflect.Ptr && !r.IsNil() {
+			return forGo(sc, r.Elem().Interface(), typ)
+		}
 	}
-	return reflect.ValueOf(v)
+	mismatch(v, typ, "")
+	panic("unreachable")
 }
 
-func wrapFunc(f interface{}) function {
-	// TODO patch reflect so we can do type compatibility-checking
-	return func(sc *scope, ss []sexpr) sexpr {
-		fun := reflect.ValueOf(f)
+// isBasic reports whether values of kind are numbers, strings or booleans,
+// which Lisp has values of its own for.
+func isBasic(kind reflect.Kind) bool {
+	return kind >= reflect.Bool && kind <= reflect.Complex128 ||
+		kind == reflect.String
+}
 
-		t := fun.Type()
-		ni := t.NumIn()
-		if ni != len(ss) && !t.IsVariadic() {
-			panic("Invalid number of arguments")
+// missingMethod describes why t does not implement the interface typ.
+func missingMethod(t, typ reflect.Type) string {
+	for i := 0; i < typ.NumMethod(); i++ {
+		m := typ.Method(i)
+		if _, ok := t.MethodByName(m.Name); !ok {
+			return "missing method " + m.Name
 		}
+	}
+	return "does not implement " + typ.String()
+}
+
+// argForGo converts the Lisp value v passed as argument number arg of a call
+// to a Go value of type typ.
+func argForGo(sc *scope, v sexpr, typ reflect.Type, arg int) reflect.Value {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(*typeError); ok && e.arg == 0 {
+				e.arg = arg
+			}
+			panic(r)
+		}
+	}()
+	return forGo(sc, v, typ)
+}
 
-		vs := make([]reflect.Value, len(ss))
-		for i, s := range ss {
-			// get argument type
-			var at reflect.Type
-			if t.IsVariadic() && i >= ni-1 {
-				st := t.In(ni - 1)
-				at = st.Elem()
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// makeCallback returns a Go func of type typ that calls the Lisp function f
+// in sc. The Go arguments are converted with wrapGoval, and the Lisp result
+// with forGo. A func with several results expects f to return them as
+// multiple values or as a list. If the last result is an error, f may leave
+// it out, and a panic in f is returned as that error rather than propagated.
+func makeCallback(sc *scope, f sexpr, typ reflect.Type) reflect.Value {
+	return reflect.MakeFunc(typ, func(in []reflect.Value) (out []reflect.Value) {
+		n := typ.NumOut()
+		returnsError := n > 0 && typ.Out(n-1) == errorType
+		if returnsError {
+			defer func() {
+				if r := recover(); r != nil {
+					out = make([]reflect.Value, n)
+					for i := 0; i < n-1; i++ {
+						out[i] = reflect.Zero(typ.Out(i))
+					}
+					out[n-1] = errorValue(asError(r))
+				}
+			}()
+		}
+
+		var args []sexpr
+		for i, v := range in {
+			if typ.IsVariadic() && i == len(in)-1 {
+				// pass the variadic arguments individually
+				for j := 0; j < v.Len(); j++ {
+					args = append(args, wrapGoval(v.Index(j)))
+				}
 			} else {
-				at = t.In(i)
+				args = append(args, wrapGoval(v))
 			}
-			// TODO convert any cons and function arguments
-			vs[i] = forGo(s, at)
 		}
-		r := fun.Call(vs)
-		if len(r) == 0 {
-			return Nil
+		r := apply(sc, f, args)
+
+		var rs []sexpr
+		switch {
+		case n == 0:
+			return nil
+		case n == 1:
+			rs = []sexpr{primary(r)}
+		default:
+			var ok bool
+			if m, isValues := r.(*multipleValues); isValues {
+				rs = m.vals
+			} else if rs, ok = listItems(r); !ok {
+				panic("Invalid return value")
+			}
 		}
-		return wrapGoval(r[0])
+		if returnsError && len(rs) == n-1 {
+			rs = append(rs, Nil)
+		}
+		if len(rs) != n {
+			panic("Invalid number of return values")
+		}
+		out = make([]reflect.Value, n)
+		for i, r := range rs {
+			if i == n-1 && returnsError {
+				out[i] = errorValue(r)
+			} else {
+				out[i] = forGo(sc, r, typ.Out(i))
+			}
+		}
+		return out
+	})
+}
+
+// errorValue converts a Lisp value returned for a Go error: nil is no error,
+// a Go error is returned as it is, and anything else becomes an error with
+// the value as its message.
+func errorValue(v sexpr) reflect.Value {
+	switch v := v.(type) {
+	case nil:
+		return reflect.Zero(errorType)
+	case error:
+		return reflect.ValueOf(&v).Elem()
+	case string:
+		return reflect.ValueOf(errors.New(v))
+	}
+	return reflect.ValueOf(errors.New(asString(v)))
+}
+
+// sequenceItems returns the items of the vector or list v, for conversion to
+// a Go slice or array.
+func sequenceItems(v sexpr) ([]sexpr, bool) {
+	if v, ok := v.(*vector); ok {
+		return v.items, true
+	}
+	return listItems(v)
+}
+
+func wrapFunc(f interface{}) function {
+	return func(sc *scope, ss []sexpr) sexpr {
+		return callGo(sc, reflect.ValueOf(f), ss, 1)
+	}
+}
+
+// callGo calls the Go function fun with the Lisp arguments ss. A function
+// with no results returns nil, and one with several returns multiple values.
+// first is the position of ss[0] in the Lisp call, for error messages.
+func callGo(sc *scope, fun reflect.Value, ss []sexpr, first int) sexpr {
+	// TODO patch reflect so we can do type compatibility-checking
+	t := fun.Type()
+	ni := t.NumIn()
+	if ni != len(ss) && !t.IsVariadic() {
+		panic("Invalid number of arguments")
+	}
+
+	vs := make([]reflect.Value, len(ss))
+	for i, s := range ss {
+		// get argument type
+		var at reflect.Type
+		if t.IsVariadic() && i >= ni-1 {
+			st := t.In(ni - 1)
+			at = st.Elem()
+		} else {
+			at = t.In(i)
+		}
+		vs[i] = argForGo(sc, s, at, first+i)
+	}
+	r := fun.Call(vs)
+
+	if n := len(r); sc.interp.goErrors && n > 0 && t.Out(n-1) == errorType {
+		if err := r[n-1]; !err.IsNil() {
+			panic(err.Interface())
+		}
+		r = r[:n-1]
+	}
+	vals := make([]sexpr, len(r))
+	for i, v := range r {
+		vals[i] = wrapGoval(v)
+	}
+	if len(vals) == 0 {
+		return Nil
 	}
+	return makeValues(vals)
 }
@@ -1,6 +1,13 @@
 package lisp
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 )
 
@@ -8,3 +15,226 @@ import (
 
 func TestWrapGo(t *testing.T) {
 }
+
+var callbackTests = []struct {
+	src  string
+	want string
+}{
+	{`(strings.Map (lambda (r) (+ r 1)) "HAL")`, `"IBM"`},
+	{`(strings.FieldsFunc "a1b22c" (lambda (r) (< r 97)))`, `["a" "b" "c"]`},
+	{`(strings.Map strings.ToUpper "x")`, `"X"`},
+	{`(go.sorted [3 1 2] (lambda (a b) (> a b)))`, `[3 2 1]`},
+	{`(go.sum (lambda args (apply + args)))`, `6`},
+	{`(go.pair (lambda (n) (list n (string n))))`, `"7 7"`},
+	{`(go.check (lambda (s) nil))`, `"ok"`},
+	{`(go.check (lambda (s) "bad"))`, `"bad"`},
+	{`(go.check (lambda (s) (panic 'oops)))`,
+		`"1:23: oops in (panic (quote oops))"`},
+	{`(go.lookup (lambda (k) (list 1)))`, `"1 <nil>"`},
+	{`(go.lookup (lambda (k) (panic "missing")))`, `"0 missing"`},
+}
+
+func TestCallbacks(t *testing.T) {
+	in := New()
+	in.Define("strings.Map", strings.Map)
+	in.Define("strings.FieldsFunc", strings.FieldsFunc)
+	in.Define("strings.ToUpper", func(r rune) rune {
+		return []rune(strings.ToUpper(string(r)))[0]
+	})
+	in.Define("go.sorted", func(xs []int, less func(a, b int) bool) []int {
+		sort.Slice(xs, func(i, j int) bool { return less(xs[i], xs[j]) })
+		return xs
+	})
+	in.Define("go.sum", func(f func(...int) int) int { return f(1, 2, 3) })
+	in.Define("go.pair", func(f func(int) (int, string)) string {
+		n, s := f(7)
+		return fmt.Sprint(n, " ", s)
+	})
+	in.Define("go.check", func(f func(string) error) string {
+		if err := f("x"); err != nil {
+			return err.Error()
+		}
+		return "ok"
+	})
+	in.Define("go.lookup", func(f func(string) (int, error)) string {
+		n, err := f("k")
+		if err != nil {
+			var e *Error
+			if errors.As(err, &e) {
+				return fmt.Sprint(n, " ", e.Value)
+			}
+		}
+		return fmt.Sprint(n, " ", err)
+	})
+	for _, test := range callbackTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestCallbackErrors(t *testing.T) {
+	in := New()
+	in.Define("go.call", func(f func() int) int { return f() })
+	in.Define("go.pair", func(f func() (int, int)) int {
+		a, b := f()
+		return a + b
+	})
+	for _, src := range []string{
+		`(go.call 1)`,
+		`(go.call (lambda () "one"))`,
+		`(go.call (lambda () (panic 'oops)))`,
+		`(go.pair (lambda () (list 1)))`,
+		`(go.pair (lambda () 1))`,
+	} {
+		if _, err := in.Eval(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
+
+type intList []int
+type numbers []int
+
+func TestForGoNative(t *testing.T) {
+	in := New()
+	in.Define("go.buffer", func() *bytes.Buffer { return new(bytes.Buffer) })
+	in.Define("go.write", func(w io.Writer, s string) { io.WriteString(w, s) })
+	in.Define("go.string", func(s fmt.Stringer) string { return s.String() })
+	in.Define("go.list", func() intList { return intList{1, 2} })
+	in.Define("go.len", func(n numbers) int { return len(n) })
+	in.Define("go.chan", func() chan interface{} {
+		c := make(chan interface{}, 1)
+		c <- "x"
+		return c
+	})
+	in.Define("go.recv", func(c <-chan interface{}) interface{} { return <-c })
+	in.Define("go.any", func(x interface{}) interface{} { return x })
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`(let ((b (go.buffer)))
+			(begin (go.write b "hi") (go.string b)))`, `"hi"`},
+		{`(go.len (go.list))`, `2`},
+		{`(go.len [1 2 3])`, `3`},
+		{`(go.recv (go.chan))`, `"x"`},
+		{`(go.any nil)`, `nil`},
+		{`(go.any 'a)`, `a`},
+	}
+	for _, test := range tests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestForGoErrors(t *testing.T) {
+	in := New()
+	in.Define("go.int", func(a string, n int) int { return n })
+	in.Define("go.byte", func(b byte) byte { return b })
+	in.Define("go.write", func(w io.Writer) {})
+	in.Define("go.ints", func(ns []int) {})
+	in.Define("go.pair", func(p [2]int) {})
+	in.Define("go.call", func(f func()) {})
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`(go.int "a" "b")`,
+			`Argument 2: cannot use "b" (string) as int`},
+		{`(go.byte 256)`,
+			`Argument 1: cannot use 256 (integer) as uint8: overflows`},
+		{`(go.byte -1)`, `Argument 1: cannot use -1 (integer) as uint8`},
+		{`(go.write 1)`, `Argument 1: cannot use 1 (integer) as io.Writer: ` +
+			`missing method Write`},
+		{`(go.ints [1 "x"])`, `Argument 1: cannot use "x" (string) as int`},
+		{`(go.ints 'a)`, `Argument 1: cannot use a (symbol) as []int`},
+		{`(go.pair [1])`,
+			`Argument 1: cannot use [1] (vector) as [2]int: length 1`},
+		{`(go.call 1.5)`, `Argument 1: cannot use 1.5 (float) as func()`},
+	}
+	for _, test := range tests {
+		_, err := in.Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
+
+func newImportInterpreter() *Interpreter {
+	in := New()
+	in.Import("strings", map[string]interface{}{
+		"Split":       strings.Split,
+		"Join":        strings.Join,
+		"ToUpper":     strings.ToUpper,
+		"\x00Builder": reflect.TypeOf((*strings.Builder)(nil)).Elem(),
+	})
+	in.Import("net/http", map[string]interface{}{"MethodGet": "GET"})
+	in.Import("example.com/api/v2", map[string]interface{}{"Version": int64(2)})
+	return in
+}
+
+func TestImport(t *testing.T) {
+	tests := []struct {
+		imp, src, want string
+	}{
+		{`(import "strings")`, `(strings.ToUpper "a")`, `"A"`},
+		{`(import "net/http")`, `http.MethodGet`, `"GET"`},
+		{`(import "net/http" :as h)`, `h.MethodGet`, `"GET"`},
+		{`(import "example.com/api/v2")`, `api.Version`, `2`},
+		{`(import "strings" Split Join)`,
+			`(strings.Join (strings.Split "a,b" ",") "-")`, `"a-b"`},
+		{`(import "strings" :as s Builder)`,
+			`(begin (define b (new s.Builder))
+				(s.Builder.WriteString b "x")
+				(s.Builder.String b))`, `"x"`},
+	}
+	for _, test := range tests {
+		in := newImportInterpreter()
+		mustEval(t, in, test.imp)
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s: %s = %s, want %s", test.imp, test.src, s, test.want)
+		}
+	}
+
+	in := newImportInterpreter()
+	mustEval(t, in, `(import "strings" Split)`)
+	if _, err := in.Eval(`strings.ToUpper`); err == nil {
+		t.Error("strings.ToUpper was imported without being selected")
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{`(import "net/htp")`,
+			`Package not found: "net/htp"; did you mean "net/http"?`},
+		{`(import "http")`,
+			`Package not found: "http"; did you mean "net/http"?`},
+		{`(import "nothing/like/it")`, `Package not found: "nothing/like/it"`},
+		{`(import "strings" Splt)`,
+			`strings has no identifier Splt; did you mean "Split"?`},
+		{`(import "strings" :from x)`, `Invalid import option :from`},
+		{`(import "strings" :as)`, `Invalid import option :as`},
+		{`(import 'strings)`, `Invalid argument`},
+	}
+	for _, test := range tests {
+		_, err := newImportInterpreter().Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
@@ -0,0 +1,408 @@
+package lisp
+
+import "sync/atomic"
+
+// Lambda bodies are compiled into code for the VM in vm.go the first time the
+// lambda is called. The compiler expands macros once instead of on every
+// evaluation, and resolves each variable bound by an enclosing lambda or let
+// to its lexical address: how many scopes up the chain it is bound, and in
+// which slot of that scope. Only variables that are not bound lexically are
+// looked up by name. Everything the compiler does not handle itself (most
+// primitives, malformed forms) is left to eval, so compiled and interpreted
+// code behave the same.
+//
+// Macros and primitives in operator position are recognised by what the
+// operator symbol is bound to when the lambda is compiled, and the lambda is
+// compiled again if any macro or primitive is bound or rebound after that.
+// Any other operator is checked when the call is made; if it turns out to be
+// a macro or primitive, the form is handed to eval after all.
+
+type opcode uint8
+
+const (
+	opConst     opcode = iota // push consts[a]
+	opLocal                   // push slot a of the scope b levels up
+	opLookup                  // push the value of the free variable consts[a]
+	opPop                     // discard the top of the stack
+	opJump                    // continue at a
+	opJumpFalse               // pop a value; continue at a if it is false
+	opOperator                // check the operator of the form consts[a]
+	opCall                    // call a function with a arguments
+	opTailCall                // same, in tail position
+	opReturn                  // return the top of the stack
+	opDefine                  // define the symbol consts[a]
+	opLambda                  // make a lambda from the lambdaForm consts[a]
+	opEval                    // evaluate the form consts[a] with eval
+	opLet                     // bind the names consts[a] in a new scope
+	opUnlet                   // leave the scope made by opLet
+)
+
+type instr struct {
+	op opcode
+	a  int
+	b  int
+}
+
+// A code is the compiled body of a lambda.
+type code struct {
+	instrs []instr
+	forms  []sexpr // forms[i] is the form instrs[i] belongs to
+	consts []sexpr
+}
+
+// A proc holds what is known about a lambda expression before it is called:
+// its parameters and, once compiled, its code. All lambdas made by evaluating
+// the same compiled lambda expression share one proc.
+type proc struct {
+	names []sym // parameter names, in slot order
+	rest  bool  // whether the last parameter takes the remaining arguments
+	slots bool  // whether the parameters could be turned into slots
+
+	// The names bound by the compiled scopes around the lambda expression,
+	// innermost last.
+	outer [][]sym
+
+	compiled atomic.Pointer[compiledCode]
+}
+
+// A compiledCode is the code of a proc, and the syntaxGen of the interpreter
+// when it was compiled.
+type compiledCode struct {
+	code *code // nil if the lambda cannot be compiled
+	gen  uint64
+}
+
+func newProc(params sexpr, outer [][]sym) *proc {
+	p := &proc{outer: outer}
+	p.names, p.rest, p.slots = paramSlots(params)
+	return p
+}
+
+// A lambdaForm is a lambda expression inside compiled code.
+type lambdaForm struct {
+	params sexpr
+	body   sexpr
+	proc   *proc
+}
+
+// compiled returns the compiled code of l, compiling it if necessary, or nil
+// if l is to be interpreted by eval. Code compiled before a macro or
+// primitive was bound or rebound is compiled again.
+func (l *lambda) compiled() *code {
+	in := l.env.interp
+	if !in.compile {
+		return nil
+	}
+	gen := atomic.LoadUint64(&in.syntaxGen)
+	if c := l.proc.compiled.Load(); c != nil && c.gen == gen {
+		return c.code
+	}
+	c := &compiledCode{compileLambda(l), gen}
+	l.proc.compiled.Store(c)
+	return c.code
+}
+
+type compiler struct {
+	c   *code
+	env *scope // the scope the lambda was created in
+
+	// The names bound by the scopes the code runs in, innermost last. The
+	// lambda's own parameters and the lets inside it follow the scopes of
+	// proc.outer.
+	scopes [][]sym
+}
+
+// compileLambda compiles the body of l, or returns nil if its parameter
+// specification is one that only eval understands.
+func compileLambda(l *lambda) (c *code) {
+	if !l.proc.slots {
+		return nil
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			// leave it to eval
+			c = nil
+		}
+	}()
+	scopes := append(l.proc.outer[:len(l.proc.outer):len(l.proc.outer)],
+		l.proc.names)
+	cp := &compiler{c: new(code), env: l.env, scopes: scopes}
+	cp.expr(l.body, true)
+	cp.emit(opReturn, 0, l.body)
+	return cp.c
+}
+
+// paramSlots converts a parameter specification to a list of slot names. It
+// fails if the specification is malformed or binds a name twice.
+func paramSlots(params sexpr) (names []sym, rest bool, ok bool) {
+	for params != nil {
+		switch p := params.(type) {
+		case cons:
+			s, k := p.car.(sym)
+			if !k {
+				return nil, false, false
+			}
+			names = append(names, s)
+			params = p.cdr
+		case sym:
+			names = append(names, p)
+			rest = true
+			params = nil
+		default:
+			return nil, false, false
+		}
+	}
+	return names, rest, distinct(names)
+}
+
+// bindSlots checks the arguments ss of a call against n parameters and
+// returns the values of the parameters' slots.
+func bindSlots(n int, rest bool, ss []sexpr) []sexpr {
+	vals := make([]sexpr, n)
+	if rest {
+		// A rest parameter takes at least one argument.
+		if len(ss) < n {
+			panic("Invalid number of arguments")
+		}
+		copy(vals, ss[:n-1])
+		vals[n-1] = unflatten(ss[n-1:])
+		return vals
+	}
+	if len(ss) != n {
+		panic("Invalid number of arguments")
+	}
+	copy(vals, ss)
+	return vals
+}
+
+// emit appends an instruction for form and returns its index.
+func (cp *compiler) emit(op opcode, a int, form sexpr) int {
+	cp.c.instrs = append(cp.c.instrs, instr{op: op, a: a})
+	cp.c.forms = append(cp.c.forms, form)
+	return len(cp.c.instrs) - 1
+}
+
+// constant adds v to the constants and returns its index.
+func (cp *compiler) constant(v sexpr) int {
+	cp.c.consts = append(cp.c.consts, v)
+	return len(cp.c.consts) - 1
+}
+
+// here returns the index of the next instruction.
+func (cp *compiler) here() int {
+	return len(cp.c.instrs)
+}
+
+// resolve returns the lexical address of the variable s: the number of
+// scopes up from the current one it is bound in and its slot there. ok is
+// false if s is free.
+func (cp *compiler) resolve(s sym) (depth, slot int, ok bool) {
+	for i := len(cp.scopes) - 1; i >= 0; i-- {
+		for j, n := range cp.scopes[i] {
+			if n == s {
+				return len(cp.scopes) - 1 - i, j, true
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// bound reports whether s is bound lexically.
+func (cp *compiler) bound(s sym) bool {
+	_, _, ok := cp.resolve(s)
+	return ok
+}
+
+// expr compiles code that pushes the value of e. tail tells whether e is in
+// tail position.
+func (cp *compiler) expr(e sexpr, tail bool) {
+	switch e := e.(type) {
+	case sym:
+		if depth, slot, ok := cp.resolve(e); ok {
+			i := cp.emit(opLocal, slot, e)
+			cp.c.instrs[i].b = depth
+		} else {
+			i := cp.emit(opLookup, cp.constant(e), e)
+			cp.c.instrs[i].b = len(cp.scopes)
+		}
+	case cons:
+		cp.form(e, tail)
+	case *hashMap, *vector:
+		cp.emit(opEval, cp.constant(e), e)
+	default:
+		cp.emit(opConst, cp.constant(e), e)
+	}
+}
+
+func (cp *compiler) form(c cons, tail bool) {
+	args, ok := listItems(c.cdr)
+	if !ok {
+		cp.eval(c)
+		return
+	}
+	if s, ok := c.car.(sym); ok && !cp.bound(s) {
+		v, _ := cp.env.get(s)
+		switch v := v.(type) {
+		case macro:
+			if x, ok := expandQuietly(v, args); ok {
+				cp.expr(x, tail)
+			} else {
+				cp.eval(c)
+			}
+			return
+		case primitive_t:
+			if !cp.special(v.name, c, args, tail) {
+				cp.eval(c)
+			}
+			return
+		}
+	}
+
+	// An application. The operator may still turn out to be a macro or
+	// primitive, in which case opOperator skips the call.
+	cp.expr(c.car, false)
+	check := cp.emit(opOperator, cp.constant(c), c)
+	for _, a := range args {
+		cp.expr(a, false)
+	}
+	if tail {
+		cp.emit(opTailCall, len(args), c)
+	} else {
+		cp.emit(opCall, len(args), c)
+	}
+	cp.c.instrs[check].b = cp.here()
+}
+
+// special compiles the primitive form c natively if it can, and reports
+// whether it did.
+func (cp *compiler) special(name string, c cons, args []sexpr, tail bool) bool {
+	switch name {
+	case "quote":
+		if len(args) != 1 {
+			return false
+		}
+		cp.emit(opConst, cp.constant(args[0]), c)
+
+	case "if":
+		if len(args) < 2 || len(args) > 3 {
+			return false
+		}
+		cp.expr(args[0], false)
+		jf := cp.emit(opJumpFalse, 0, c)
+		cp.expr(args[1], tail)
+		j := cp.emit(opJump, 0, c)
+		cp.c.instrs[jf].a = cp.here()
+		if len(args) == 3 {
+			cp.expr(args[2], tail)
+		} else {
+			cp.emit(opConst, cp.constant(Nil), c)
+		}
+		cp.c.instrs[j].a = cp.here()
+
+	case "begin":
+		cp.body(args, tail, c)
+
+	case "let":
+		if len(args) < 1 {
+			return false
+		}
+		names, vals, ok := letBindings(args[0])
+		if !ok || !distinct(names) {
+			return false
+		}
+		for _, v := range vals {
+			cp.expr(v, false)
+		}
+		cp.emit(opLet, cp.constant(names), c)
+		cp.scopes = append(cp.scopes, names)
+		cp.body(args[1:], tail, c)
+		cp.scopes = cp.scopes[:len(cp.scopes)-1]
+		cp.emit(opUnlet, 0, c)
+
+	case "define":
+		if len(args) != 2 {
+			return false
+		}
+		s, ok := args[0].(sym)
+		if !ok {
+			return false
+		}
+		cp.expr(args[1], false)
+		cp.emit(opDefine, cp.constant(s), c)
+
+	case "lambda":
+		if len(args) != 2 {
+			return false
+		}
+		outer := make([][]sym, len(cp.scopes))
+		copy(outer, cp.scopes)
+		lf := &lambdaForm{args[0], args[1], newProc(args[0], outer)}
+		cp.emit(opLambda, cp.constant(lf), c)
+
+	default:
+		return false
+	}
+	return true
+}
+
+// body compiles the forms of a begin or let body.
+func (cp *compiler) body(forms []sexpr, tail bool, c cons) {
+	if len(forms) == 0 {
+		cp.emit(opConst, cp.constant(Nil), c)
+	}
+	for i, e := range forms {
+		last := i == len(forms)-1
+		cp.expr(e, tail && last)
+		if !last {
+			cp.emit(opPop, 0, c)
+		}
+	}
+}
+
+// letBindings splits the bindings of a let into names and value forms. It
+// fails if the bindings are malformed.
+func letBindings(bindings sexpr) (names []sym, vals []sexpr, ok bool) {
+	bs, ok := listItems(bindings)
+	if !ok {
+		return nil, nil, false
+	}
+	for _, b := range bs {
+		pair, ok := listItems(b)
+		if !ok || len(pair) != 2 {
+			return nil, nil, false
+		}
+		s, ok := pair[0].(sym)
+		if !ok {
+			return nil, nil, false
+		}
+		names = append(names, s)
+		vals = append(vals, pair[1])
+	}
+	return names, vals, true
+}
+
+// eval compiles code that leaves the evaluation of c to eval.
+func (cp *compiler) eval(c cons) {
+	cp.emit(opEval, cp.constant(c), c)
+}
+
+// listItems is like flatten, but reports whether s is a proper list instead
+// of panicking.
+func listItems(s sexpr) ([]sexpr, bool) {
+	if !isList(s) {
+		return nil, false
+	}
+	return flatten(s), true
+}
+
+// expandQuietly expands a macro invocation, reporting whether the expansion
+// succeeded. Expansions that fail are left to eval, which reports the error
+// when the form is evaluated.
+func expandQuietly(m macro, args []sexpr) (x sexpr, ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			ok = false
+		}
+	}()
+	return m.expand(args), true
+}
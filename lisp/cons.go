@@ -4,7 +4,7 @@ func builtinCons(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 2 {
 		panic("Invalid number of arguments")
 	}
-	return cons{ss[0], ss[1]}
+	return cons{car: ss[0], cdr: ss[1]}
 }
 
 func builtinCar(sc *scope, ss []sexpr) sexpr {
@@ -31,6 +31,6 @@ func builtinList(sc *scope, ss []sexpr) sexpr {
 	if len(ss) == 0 {
 		return Nil
 	}
-	return cons{ss[0], builtinList(sc, ss[1:len(ss)])}
+	return cons{car: ss[0], cdr: builtinList(sc, ss[1:len(ss)])}
 }
 
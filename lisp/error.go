@@ -0,0 +1,134 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An Error describes a panic raised while reading or evaluating Lisp code.
+type Error struct {
+	// Value is the value the Lisp code panicked with, such as the symbol
+	// given to (panic 'id) or the message of a failed builtin.
+	Value interface{}
+
+	// Form is the innermost form being evaluated when the panic happened.
+	// It is nil for errors raised while reading.
+	Form Value
+
+	// Pos is the source position of the innermost form with a known
+	// position, or nil if there is none.
+	Pos *Pos
+
+	// Backtrace holds one frame for each Lisp function that was active when
+	// the panic happened, innermost first. The last frame describes the
+	// code outside of any function.
+	Backtrace []Frame
+}
+
+// A Frame is a single entry in the backtrace of an Error.
+type Frame struct {
+	// Name is the name of the function, or "lambda" for an anonymous one.
+	// It is empty for the outermost frame.
+	Name string
+
+	// Form is the innermost form that was being evaluated in the frame.
+	Form Value
+	Pos  *Pos
+}
+
+func (e *Error) Error() string {
+	msg := valueString(e.Value)
+	if e.Form != nil {
+		msg = fmt.Sprintf("%s in %s", msg, asString(e.Form))
+	}
+	if e.Pos != nil {
+		msg = fmt.Sprintf("%s: %s", e.Pos, msg)
+	}
+	return msg
+}
+
+// BacktraceString formats the backtrace of e, one frame per line.
+func (e *Error) BacktraceString() string {
+	lines := make([]string, len(e.Backtrace))
+	for i, f := range e.Backtrace {
+		lines[i] = fmt.Sprintf("%d: %s", i, f)
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (f Frame) String() string {
+	s := asString(f.Form)
+	if f.Pos != nil {
+		s = fmt.Sprintf("%s at %s", s, f.Pos)
+	}
+	if f.Name != "" {
+		s = fmt.Sprintf("%s: %s", f.Name, s)
+	}
+	return s
+}
+
+// valueString formats a panic value for an error message.
+func valueString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case error:
+		return v.Error()
+	}
+	return asString(v)
+}
+
+// asError converts the recovered panic value r to an *Error.
+func asError(r interface{}) *Error {
+	e, ok := r.(*Error)
+	if !ok {
+		e = &Error{Value: r}
+	}
+	if len(e.Backtrace) == 0 {
+		e.Backtrace = []Frame{{}}
+	}
+	return e
+}
+
+// wrapError converts the recovered panic value r to an *Error, noting that
+// form was being evaluated.
+func wrapError(r interface{}, form sexpr) *Error {
+	pos := posOf(form)
+	e := asError(r)
+	if e.Form == nil {
+		e.Form = form
+	}
+	if e.Pos == nil {
+		e.Pos = pos
+	}
+	f := &e.Backtrace[len(e.Backtrace)-1]
+	if f.Form == nil {
+		f.Form = form
+	}
+	if f.Pos == nil {
+		f.Pos = pos
+	}
+	return e
+}
+
+// wrapCall converts the recovered panic value r to an *Error, noting that it
+// escaped a call to l. Forms evaluated outside l go into a new frame.
+func wrapCall(r interface{}, l *lambda) *Error {
+	e := asError(r)
+	name := string(l.name)
+	if name == "" {
+		name = "lambda"
+	}
+	e.Backtrace[len(e.Backtrace)-1].Name = name
+	e.Backtrace = append(e.Backtrace, Frame{})
+	return e
+}
+
+// panicValue returns the value originally given to panic, unwrapping r if it
+// is an *Error.
+func panicValue(r interface{}) interface{} {
+	if e, ok := r.(*Error); ok {
+		return e.Value
+	}
+	return r
+}
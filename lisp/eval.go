@@ -1,52 +1,106 @@
 package lisp
 
 // eval evaluates an s-expression, including syntax transformations (macros).
+//
+// Forms in tail position (the branches of if, the last form of begin and let,
+// the bodies of lambdas and the results of macro expansions) are evaluated by
+// looping rather than by recursing, so tail calls run in constant Go stack.
 func eval(sc *scope, e sexpr) sexpr {
-	switch e := e.(type) {
-	case cons: // a function, primitive or macro to evaluate
-		cons := e
-		car := eval(sc, cons.car)
-		cdr := cons.cdr
+	switch e.(type) {
+	case cons:
+	case sym:
+		return sc.lookup(e.(sym))
+	case *hashMap:
+		return evalMap(sc, e.(*hashMap))
+	case *vector:
+		return evalVector(sc, e.(*vector))
+	default:
+		return e
+	}
+
+	form := e
+	var fn *lambda // the function whose body e belongs to, if not form's
+	defer func() {
+		if r := recover(); r != nil {
+			err := wrapError(r, e)
+			if fn != nil {
+				wrapCall(err, fn)
+				wrapError(err, form)
+			}
+			panic(err)
+		}
+	}()
+	for {
+		var c cons
+		switch e2 := e.(type) {
+		case cons: // a function, primitive or macro to evaluate
+			c = e2
+		case sym:
+			return sc.lookup(e2)
+		case *hashMap:
+			return evalMap(sc, e2)
+		case *vector:
+			return evalVector(sc, e2)
+		default:
+			return e
+		}
+		car := eval(sc, c.car)
+		cdr := c.cdr
 		args := flatten(cdr)
 		switch f := car.(type) {
 		case function:
 			// Evaluate all arguments
 			for i, a := range args {
-				args[i] = eval(sc, a)
+				args[i] = primary(eval(sc, a))
 			}
 			return f(sc, args)
 
+		case *lambda:
+			for i, a := range args {
+				args[i] = primary(eval(sc, a))
+			}
+			if c := f.compiled(); c != nil {
+				return f.run(c, args)
+			}
+			// Continue with the body in place of the call.
+			sc = f.bind(args)
+			e = f.body
+			fn = f
+
 		case primitive_t:
 			// Run without first evaluating the arguments.
-			return f.f(sc, args)
+			if f.tail != nil {
+				sc, e = f.tail(sc, args)
+			} else {
+				return f.f(sc, args)
+			}
 
 		case macro:
 			// Expand the macro invocation and then evaluate the result.
-			return eval(sc, f.expand(args))
+			e = f.expand(args)
 
 		default:
 			msg := ("Attempted application on something other " +
 				"than a function, primitive or macro")
 			panic(msg)
 		}
-	case sym:
-		return sc.lookup(e)
 	}
-	return e
 }
 
 func apply(sc *scope, e sexpr, ss []sexpr) sexpr {
-	f, ok := e.(function)
-	if !ok {
-		panic("Attempted application on non-function")
+	switch f := e.(type) {
+	case function:
+		return f(sc, ss)
+	case *lambda:
+		return f.call(ss)
 	}
-	return f(sc, ss)
+	panic("Attempted application on non-function")
 }
 
 func unflatten(ss []sexpr) sexpr {
 	c := sexpr(nil)
 	for i := len(ss) - 1; i >= 0; i-- {
-		c = cons{ss[i], c}
+		c = cons{car: ss[i], cdr: c}
 	}
 	return c
 }
@@ -0,0 +1,75 @@
+package lisp
+
+import (
+	"runtime/debug"
+	"strings"
+	"testing"
+)
+
+// Each of these loops a million times through a different kind of tail
+// position. With a bounded stack, they only pass if tail calls do not grow
+// the Go stack.
+var tailCallTests = []struct {
+	name string
+	src  string
+}{
+	{"if", `(define loop (lambda (n)
+		(if (= n 0) 'done (loop (- n 1)))))`},
+	{"begin", `(define loop (lambda (n)
+		(begin
+			nil
+			(if (= n 0) 'done (loop (- n 1))))))`},
+	{"let", `(define loop (lambda (n)
+		(let ((m (- n 1)))
+			(if (< m 0) 'done (loop m)))))`},
+	{"macro", `(begin
+		(defmacro again (n) (list 'loop (list '- n 1)))
+		(define loop (lambda (n)
+			(if (= n 0) 'done (again n)))))`},
+	{"mutual", `(begin
+		(define even (lambda (n) (if (= n 0) 'done (loop (- n 1)))))
+		(define loop (lambda (n) (if (= n 0) 'done (even (- n 1))))))`},
+}
+
+func TestTailCalls(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	for _, test := range tailCallTests {
+		in := New()
+		if err := in.Exec(strings.NewReader(test.src)); err != nil {
+			t.Fatalf("%s: %s", test.name, err)
+		}
+		v, err := in.Eval("(loop 1000000)")
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+		} else if v != sym("done") {
+			t.Errorf("%s: got %s, want done", test.name, asString(v))
+		}
+	}
+}
+
+func TestLenLongList(t *testing.T) {
+	defer debug.SetMaxStack(debug.SetMaxStack(1 << 20))
+	in := New()
+	in.Exec(strings.NewReader(`(define build (lambda (n acc)
+		(if (= n 0) acc (build (- n 1) (cons n acc)))))`))
+	v, err := in.Eval("(len (build 1000000 nil))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != int64(1000000) {
+		t.Errorf("got %s, want 1000000", asString(v))
+	}
+}
+
+func TestTailCallBacktrace(t *testing.T) {
+	in := New()
+	in.Exec(strings.NewReader(`
+		(define g (lambda (x) (car x)))
+		(define f (lambda (x) (g x)))`))
+	_, err := in.Eval("(f 5)")
+	e := err.(*Error)
+	if len(e.Backtrace) != 2 || e.Backtrace[0].Name != "g" ||
+		asString(e.Backtrace[1].Form) != "(f 5)" {
+		t.Errorf("Backtrace = %v", e.Backtrace)
+	}
+}
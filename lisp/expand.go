@@ -0,0 +1,271 @@
+package lisp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+)
+
+// macroexpand1 expands form once if it is the application of a macro that is
+// defined in sc and not shadowed, reporting whether it was.
+func macroexpand1(sc *scope, form sexpr, shadowed map[sym]bool) (sexpr, bool) {
+	c, ok := form.(cons)
+	if !ok {
+		return form, false
+	}
+	s, ok := c.car.(sym)
+	if !ok || shadowed[s] {
+		return form, false
+	}
+	v, _ := sc.get(s)
+	m, ok := v.(macro)
+	if !ok {
+		return form, false
+	}
+	args, ok := listItems(c.cdr)
+	if !ok {
+		return form, false
+	}
+	return m.expand(args), true
+}
+
+// macroexpand expands form until it is no longer the application of a macro.
+func macroexpand(sc *scope, form sexpr, shadowed map[sym]bool) sexpr {
+	for {
+		x, ok := macroexpand1(sc, form, shadowed)
+		if !ok {
+			return form
+		}
+		form = x
+	}
+}
+
+// macroexpandAll expands all the macro applications in form. Quoted forms are
+// left alone, and the variables that lambda, let and multiple-value-bind
+// bind shadow macros of the same name in their bodies.
+func macroexpandAll(sc *scope, form sexpr, shadowed map[sym]bool) sexpr {
+	form = macroexpand(sc, form, shadowed)
+	switch x := form.(type) {
+	case *vector:
+		return &vector{expandItems(sc, x.items, shadowed)}
+	case *hashMap:
+		return mapLiteral(expandItems(sc, x.literal(), shadowed))
+	case cons:
+	default:
+		return form
+	}
+
+	c := form.(cons)
+	items, ok := listItems(c)
+	if !ok {
+		return form
+	}
+	name, _ := items[0].(sym)
+	if shadowed[name] {
+		name = ""
+	}
+	switch {
+	case name == "quote" || name == "syntax-rules" || name == "define-syntax":
+		return form
+	case name == "quasiquote" && len(items) == 2:
+		return withPos(c, unflatten([]sexpr{items[0],
+			expandQuasi(sc, items[1], 1, shadowed)}))
+	case (name == "lambda" || name == "defmacro") && len(items) >= 3:
+		i, params := 1, items[1]
+		if name == "defmacro" {
+			i, params = 2, unflatten(parseLambdaList(items[2]).names(nil))
+		}
+		inner := shadow(shadowed, params)
+		out := append([]sexpr{}, items[:i+1]...)
+		out = append(out, expandItems(sc, items[i+1:], inner)...)
+		return withPos(c, unflatten(out))
+	case name == "let" && len(items) >= 2:
+		bindings, ok := listItems(items[1])
+		if !ok {
+			break
+		}
+		var names []sexpr
+		newBindings := make([]sexpr, len(bindings))
+		for i, b := range bindings {
+			pair, ok := listItems(b)
+			if !ok || len(pair) != 2 {
+				newBindings[i] = b
+				continue
+			}
+			names = append(names, pair[0])
+			newBindings[i] = unflatten([]sexpr{pair[0],
+				macroexpandAll(sc, pair[1], shadowed)})
+		}
+		inner := shadow(shadowed, unflatten(names))
+		out := []sexpr{items[0], unflatten(newBindings)}
+		out = append(out, expandItems(sc, items[2:], inner)...)
+		return withPos(c, unflatten(out))
+	case name == "multiple-value-bind" && len(items) >= 3:
+		inner := shadow(shadowed, items[1])
+		out := []sexpr{items[0], items[1], macroexpandAll(sc, items[2], shadowed)}
+		out = append(out, expandItems(sc, items[3:], inner)...)
+		return withPos(c, unflatten(out))
+	case name == "define" && len(items) == 3:
+		return withPos(c, unflatten([]sexpr{items[0], items[1],
+			macroexpandAll(sc, items[2], shadowed)}))
+	}
+	return withPos(c, unflatten(expandItems(sc, items, shadowed)))
+}
+
+func expandItems(sc *scope, items []sexpr, shadowed map[sym]bool) []sexpr {
+	out := make([]sexpr, len(items))
+	for i, x := range items {
+		out[i] = macroexpandAll(sc, x, shadowed)
+	}
+	return out
+}
+
+// expandQuasi expands the macro applications in the unquoted parts of the
+// template x of a quasiquote nested depth levels deep.
+func expandQuasi(sc *scope, x sexpr, depth int, shadowed map[sym]bool) sexpr {
+	c, ok := x.(cons)
+	if !ok {
+		return x
+	}
+	for _, q := range []sym{"unquote", "unquote-splicing"} {
+		if arg, ok := quoteForm(x, q); ok {
+			if depth == 1 {
+				return quoteWith(x, q, macroexpandAll(sc, arg, shadowed))
+			}
+			return quoteWith(x, q, expandQuasi(sc, arg, depth-1, shadowed))
+		}
+	}
+	if arg, ok := quoteForm(x, "quasiquote"); ok {
+		return quoteWith(x, "quasiquote", expandQuasi(sc, arg, depth+1, shadowed))
+	}
+	return withPos(c, cons{car: expandQuasi(sc, c.car, depth, shadowed),
+		cdr: expandQuasi(sc, c.cdr, depth, shadowed)})
+}
+
+// shadow returns shadowed with the symbols of the parameter list params
+// added.
+func shadow(shadowed map[sym]bool, params sexpr) map[sym]bool {
+	inner := make(map[sym]bool, len(shadowed))
+	for s := range shadowed {
+		inner[s] = true
+	}
+	addSyms(params, inner)
+	return inner
+}
+
+// withPos returns the list x positioned where c is.
+func withPos(c cons, x sexpr) sexpr {
+	if xc, ok := x.(cons); ok {
+		xc.pos = c.pos
+		return xc
+	}
+	return x
+}
+
+// (macroexpand-1 form)
+//
+// Expands form once if it is the application of a macro, and returns it
+// unchanged otherwise.
+func builtinMacroexpand1(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	x, _ := macroexpand1(sc, ss[0], nil)
+	return x
+}
+
+// (macroexpand form)
+//
+// Expands form until it is no longer the application of a macro.
+func builtinMacroexpand(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return macroexpand(sc, ss[0], nil)
+}
+
+// (macroexpand-all form)
+//
+// Expands all the applications of macros in form, other than in quoted forms
+// and where a variable shadows the macro.
+func builtinMacroexpandAll(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return macroexpandAll(sc, ss[0], nil)
+}
+
+// The forms that Expand evaluates as well as expanding, so that the macros
+// and functions they define can be used by the forms after them.
+var expandEvaluated = map[sym]bool{
+	"define":        true,
+	"defmacro":      true,
+	"define-syntax": true,
+	"import":        true,
+	"require":       true,
+	"in-ns":         true,
+}
+
+// Expand writes each s-expression read from ior to w with all its macro
+// applications expanded, one per line. Definitions, imports and in-ns forms
+// are also evaluated, as Exec would, so that the macros they define are
+// expanded in the forms that follow; other forms are not evaluated.
+func (in *Interpreter) Expand(ior io.Reader, w io.Writer) error {
+	return in.expand("", ior, w)
+}
+
+// ExpandFile expands the contents of the file at path, like Expand.
+func (in *Interpreter) ExpandFile(path string, w io.Writer) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	defer func(file string) { in.file = file }(in.file)
+	in.file = path
+	return in.expand(path, f, w)
+}
+
+func (in *Interpreter) expand(file string, ior io.Reader, w io.Writer) error {
+	r := newPosReader(file, bufio.NewReader(ior))
+	for {
+		e, err := read(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		x, err := expandTop(in.ns.sc, e)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(w, asString(x)); err != nil {
+			return err
+		}
+		if c, ok := x.(cons); ok {
+			if s, ok := c.car.(sym); ok && expandEvaluated[s] {
+				if _, err := evalTop(in.ns.sc, x); err != nil {
+					return err
+				}
+			}
+		}
+	}
+}
+
+// expandTop expands the top-level form e in sc, converting any panic to an
+// *Error.
+func expandTop(sc *scope, e sexpr) (x sexpr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = wrapError(r, e)
+		}
+	}()
+	return macroexpandAll(sc, e, nil), nil
+}
+
+// ExpandFile writes the contents of the file at path to w with its macros
+// expanded, using the default interpreter.
+func ExpandFile(path string, w io.Writer) error {
+	return defaultInterpreter.ExpandFile(path, w)
+}
@@ -0,0 +1,85 @@
+package lisp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const expandDefs = `
+	(defmacro sq (x) (list '* x x))
+	(defmacro twice (x) (list 'sq (list 'sq x)))
+	(defmacro unless (c . body) (list 'if c nil (cons 'begin body)))`
+
+var expandTests = []struct {
+	src  string
+	want string
+}{
+	{`(macroexpand-1 '(twice 2))`, `(sq (sq 2))`},
+	{`(macroexpand1 '(twice 2))`, `(sq (sq 2))`},
+	{`(macroexpand '(twice 2))`, `(* (sq 2) (sq 2))`},
+	{`(macroexpand '(list (sq 2)))`, `(list (sq 2))`},
+	{`(macroexpand 5)`, `5`},
+	{`(macroexpand-all '(twice 2))`, `(* (* 2 2) (* 2 2))`},
+	{`(macroexpand-all '(list 'a '(sq 1) (sq 1)))`,
+		`(list (quote a) (quote (sq 1)) (* 1 1))`},
+	{`(macroexpand-all '(unless (sq 1) [(sq 2)] {:a (sq 3)}))`,
+		`(if (* 1 1) nil (begin [(* 2 2)] {:a (* 3 3)}))`},
+	{`(macroexpand-all '(lambda (sq) (sq 2) (twice 1)))`,
+		`(lambda (sq) (sq 2) (sq (sq 1)))`},
+	{`(macroexpand-all '(let ((sq (sq 1))) (sq 2)))`,
+		`(let ((sq (* 1 1))) (sq 2))`},
+	{`(macroexpand-all '(multiple-value-bind (a sq) (sq 1) (sq a)))`,
+		`(multiple-value-bind (a sq) (* 1 1) (sq a))`},
+	{`(macroexpand-all '(defmacro m (sq &optional (n (sq 1))) (list (sq 2) sq n)))`,
+		`(defmacro m (sq &optional (n (sq 1))) (list (sq 2) sq n))`},
+	{`(macroexpand-all '(defmacro m (x &key (n 1)) (list (sq 2) x n)))`,
+		`(defmacro m (x &key (n 1)) (list (* 2 2) x n))`},
+	{`(macroexpand-all '(define x (sq 2)))`, `(define x (* 2 2))`},
+	{"(macroexpand-all '`(sq ,(sq 2) `(sq ,(sq ,(sq 3)))))",
+		"(quasiquote (sq (unquote (* 2 2)) (quasiquote (sq (unquote (sq (unquote (* 3 3))))))))"},
+}
+
+func TestMacroexpand(t *testing.T) {
+	in := New()
+	if err := in.Exec(strings.NewReader(expandDefs)); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range expandTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestExpandFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prog.lisp")
+	src := `(defmacro sq (x) (list '* x x))
+(define nine (sq 3))
+(defmacro defsq (name x) (list 'define name (list 'sq x)))
+(defsq four 2)
+(print (list nine four))
+`
+	if err := os.WriteFile(path, []byte(src), 0666); err != nil {
+		t.Fatal(err)
+	}
+	var b strings.Builder
+	in := New()
+	if err := in.ExpandFile(path, &b); err != nil {
+		t.Fatal(err)
+	}
+	want := `(defmacro sq (x) (list (quote *) x x))
+(define nine (* 3 3))
+(defmacro defsq (name x) (list (quote define) name (list (quote sq) x)))
+(define four (* 2 2))
+(print (list nine four))
+`
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+	if v := mustEval(t, in, `four`); asString(v) != "4" {
+		t.Errorf("four = %s, want 4", asString(v))
+	}
+}
@@ -0,0 +1,118 @@
+package lisp
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// A goType is a Go type made available to Lisp, such as one of the types of
+// an imported package. It is used to make values of the type with new and
+// make.
+type goType struct {
+	t reflect.Type
+}
+
+func (t goType) String() string {
+	return fmt.Sprintf("<type: %s>", t.t)
+}
+
+// typeArg returns s as a Go type, panicking if it is not one.
+func typeArg(s sexpr) reflect.Type {
+	t, ok := s.(goType)
+	if !ok {
+		panic("Invalid argument")
+	}
+	return t.t
+}
+
+// fieldName returns the field name s, which may be a symbol or a keyword.
+func fieldName(s sexpr) string {
+	switch s := s.(type) {
+	case sym:
+		return string(s)
+	case keyword:
+		return string(s)
+	}
+	panic("Invalid field name")
+}
+
+// structField returns the field name of the struct, or pointer to struct, v.
+func structField(v sexpr, name string) reflect.Value {
+	r := reflect.ValueOf(v)
+	if r.Kind() == reflect.Ptr {
+		if r.IsNil() {
+			panic("Nil pointer")
+		}
+		r = r.Elem()
+	}
+	if r.Kind() != reflect.Struct {
+		panic("Invalid argument")
+	}
+	f := r.FieldByName(name)
+	if !f.IsValid() {
+		panic(fmt.Sprintf("%s has no field %s", r.Type(), name))
+	}
+	if !f.CanInterface() {
+		panic(fmt.Sprintf("Field %s of %s is unexported", name, r.Type()))
+	}
+	return f
+}
+
+// (field obj 'Name)
+//
+// Returns the value of a field of a Go struct or pointer to a struct.
+func builtinField(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	return wrapGoval(structField(ss[0], fieldName(ss[1])))
+}
+
+// (set-field! obj 'Name value)
+//
+// Sets a field of the struct that the Go pointer obj points to.
+func builtinSetField(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	if reflect.ValueOf(ss[0]).Kind() != reflect.Ptr {
+		panic("Cannot set a field of a struct that is not a pointer")
+	}
+	f := structField(ss[0], fieldName(ss[1]))
+	f.Set(forGo(sc, ss[2], f.Type()))
+	return Nil
+}
+
+// (new type)
+//
+// Returns a pointer to a new zero value of a Go type.
+func builtinNew(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return native(reflect.New(typeArg(ss[0])).Interface())
+}
+
+// (make type :Field value ...)
+//
+// Returns a pointer to a new value of a Go struct type with the given fields
+// set.
+func builtinMake(sc *scope, ss []sexpr) sexpr {
+	if len(ss) == 0 || len(ss)%2 != 1 {
+		panic("Invalid number of arguments")
+	}
+	t := typeArg(ss[0])
+	if t.Kind() != reflect.Struct {
+		panic("Invalid argument")
+	}
+	p := reflect.New(t)
+	for i := 1; i < len(ss); i += 2 {
+		name, ok := ss[i].(keyword)
+		if !ok {
+			panic("Expected a keyword naming a field")
+		}
+		f := structField(p.Interface(), string(name))
+		f.Set(forGo(sc, ss[i+1], f.Type()))
+	}
+	return native(p.Interface())
+}
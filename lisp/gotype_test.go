@@ -0,0 +1,78 @@
+package lisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+type testServer struct {
+	Name  string
+	Port  int
+	Tags  []string
+	Inner struct{ On bool }
+	Next  *testServer
+	count int
+}
+
+func (s *testServer) Addr() string {
+	return s.Name + ":" + string(rune('0'+s.Port%10))
+}
+
+func newTypeInterpreter(t *testing.T) *Interpreter {
+	in := New()
+	in.Import("example/test", map[string]interface{}{
+		"\x00Server": reflect.TypeOf((*testServer)(nil)).Elem(),
+	})
+	in.Define("port", func(s testServer) int { return s.Port })
+	mustEval(t, in, `(import "example/test")`)
+	return in
+}
+
+var goTypeTests = []struct {
+	src  string
+	want string
+}{
+	{`:Name`, `:Name`},
+	{`(equal? :a :a)`, `true`},
+	{`test.Server`, `<type: lisp.testServer>`},
+	{`(field (new test.Server) 'Port)`, `0`},
+	{`(field (make test.Server :Name "x" :Port 80) :Name)`, `"x"`},
+	{`(field (make test.Server :Tags ["a" "b"]) 'Tags)`, `["a" "b"]`},
+	{`(let ((s (new test.Server)))
+		(begin (set-field! s 'Port 8) (field s 'Port)))`, `8`},
+	{`(field (field (make test.Server) 'Inner) 'On)`, `nil`},
+	{`(let ((s (new test.Server)))
+		(begin
+			(set-field! s 'Next (make test.Server :Port 3))
+			(field (field s 'Next) 'Port)))`, `3`},
+	{`(test.Server.Addr (make test.Server :Name "h" :Port 81))`, `"h:1"`},
+	{`(port (make test.Server :Port 5))`, `5`},
+}
+
+func TestGoTypes(t *testing.T) {
+	in := newTypeInterpreter(t)
+	for _, test := range goTypeTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestGoTypeErrors(t *testing.T) {
+	in := newTypeInterpreter(t)
+	for _, src := range []string{
+		`(field (new test.Server) 'Missing)`,
+		`(field (new test.Server) 'count)`,
+		`(field 1 'Port)`,
+		`(set-field! (new test.Server) 'Port "x")`,
+		`(make test.Server :Port)`,
+		`(make test.Server 'Port 1)`,
+		`(make 1)`,
+		`(port 1)`,
+	} {
+		if _, err := in.Eval(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
@@ -0,0 +1,251 @@
+package lisp
+
+import (
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// A hashMap is a mutable hash table from Lisp values to Lisp values. Maps are
+// written {key value ...}. Evaluating a map makes a new map from the values
+// of its keys and values, so a map literal gives a fresh map every time it is
+// evaluated, while a quoted one is left as it was read.
+//
+// Keys are compared by type and value, so 1 and 1.0 are different keys, and
+// lists are compared element by element. Go values that are not comparable
+// cannot be used as keys.
+type hashMap struct {
+	entries map[interface{}]mapEntry
+
+	// items holds the keys and values of a map literal as they were read,
+	// in order and including any repeated keys, so that evaluating it
+	// evaluates each of them in turn. It is nil for other maps, and once the
+	// map is changed.
+	items []sexpr
+}
+
+type mapEntry struct {
+	key sexpr
+	val sexpr
+}
+
+// Big numbers are pointers, so they are keyed by their text instead, and
+// conses are keyed without their source positions.
+type (
+	bigKey  string
+	ratKey  string
+	consKey struct{ car, cdr interface{} }
+)
+
+func newHashMap() *hashMap {
+	return &hashMap{entries: make(map[interface{}]mapEntry)}
+}
+
+// mapLiteral returns the map written with the keys and values items.
+func mapLiteral(items []sexpr) *hashMap {
+	m := newHashMap()
+	for i := 0; i < len(items); i += 2 {
+		m.set(items[i], items[i+1])
+	}
+	m.items = items
+	return m
+}
+
+// hashKey returns the Go map key under which the Lisp value k is stored.
+func hashKey(k sexpr) interface{} {
+	switch k := k.(type) {
+	case nil:
+		return k
+	case *big.Int:
+		return bigKey(k.String())
+	case *big.Rat:
+		return ratKey(k.String())
+	case cons:
+		return consKey{hashKey(k.car), hashKey(k.cdr)}
+	}
+	if !reflect.TypeOf(k).Comparable() {
+		panic("Invalid map key")
+	}
+	return k
+}
+
+func (m *hashMap) get(k sexpr) (sexpr, bool) {
+	e, ok := m.entries[hashKey(k)]
+	return e.val, ok
+}
+
+func (m *hashMap) set(k, v sexpr) {
+	m.entries[hashKey(k)] = mapEntry{k, v}
+	m.items = nil
+}
+
+func (m *hashMap) delete(k sexpr) {
+	delete(m.entries, hashKey(k))
+	m.items = nil
+}
+
+// literal returns the keys and values of m in the order they are to be
+// evaluated: as they were read for a map literal, and sorted otherwise.
+func (m *hashMap) literal() []sexpr {
+	if m.items != nil {
+		return m.items
+	}
+	items := make([]sexpr, 0, 2*len(m.entries))
+	for _, e := range m.sorted() {
+		items = append(items, e.key, e.val)
+	}
+	return items
+}
+
+// sorted returns the entries of m ordered by the printed form of their keys,
+// so that maps print the same way every time.
+func (m *hashMap) sorted() []mapEntry {
+	es := make([]mapEntry, 0, len(m.entries))
+	for _, e := range m.entries {
+		es = append(es, e)
+	}
+	sort.Slice(es, func(i, j int) bool {
+		return asString(es[i].key) < asString(es[j].key)
+	})
+	return es
+}
+
+func (m *hashMap) String() string {
+	strs := make([]string, 0, 2*len(m.entries))
+	for _, e := range m.sorted() {
+		strs = append(strs, asString(e.key), asString(e.val))
+	}
+	return "{" + strings.Join(strs, " ") + "}"
+}
+
+// equal reports whether m and n have equal values under the same keys.
+func (m *hashMap) equal(n *hashMap) bool {
+	if len(m.entries) != len(n.entries) {
+		return false
+	}
+	for k, e := range m.entries {
+		f, ok := n.entries[k]
+		if !ok || !equal(e.val, f.val) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalMap returns a new map holding the values of the keys and values of m,
+// evaluated in the order they were written.
+func evalMap(sc *scope, m *hashMap) *hashMap {
+	n := newHashMap()
+	items := m.literal()
+	for i := 0; i < len(items); i += 2 {
+		k := primary(eval(sc, items[i]))
+		n.set(k, primary(eval(sc, items[i+1])))
+	}
+	return n
+}
+
+// mapArg returns s as a map, panicking if it is not one.
+func mapArg(s sexpr) *hashMap {
+	m, ok := s.(*hashMap)
+	if !ok {
+		panic("Invalid argument")
+	}
+	return m
+}
+
+// (make-map [key value]...)
+//
+// Returns a new map holding the given keys and values.
+func builtinMakeMap(sc *scope, ss []sexpr) sexpr {
+	if len(ss)%2 != 0 {
+		panic("Invalid number of arguments")
+	}
+	m := newHashMap()
+	for i := 0; i < len(ss); i += 2 {
+		m.set(ss[i], ss[i+1])
+	}
+	return m
+}
+
+// (map? expr)
+//
+// Tells whether the given expression is a map.
+func builtinIsMap(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	_, ok := ss[0].(*hashMap)
+	return ok
+}
+
+// (map-get m key [default])
+//
+// Returns the value of key in m, or default (nil if not given) if m has no
+// such key.
+func builtinMapGet(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 && len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	if v, ok := mapArg(ss[0]).get(ss[1]); ok {
+		return v
+	}
+	if len(ss) == 3 {
+		return ss[2]
+	}
+	return Nil
+}
+
+// (map-set! m key value)
+func builtinMapSet(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	mapArg(ss[0]).set(ss[1], ss[2])
+	return Nil
+}
+
+// (map-delete! m key)
+func builtinMapDelete(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	mapArg(ss[0]).delete(ss[1])
+	return Nil
+}
+
+// (map-count m)
+func builtinMapCount(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return int64(len(mapArg(ss[0]).entries))
+}
+
+// (map-keys m)
+//
+// Returns a list of the keys of m, ordered as they are printed.
+func builtinMapKeys(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	es := mapArg(ss[0]).sorted()
+	keys := make([]sexpr, len(es))
+	for i, e := range es {
+		keys[i] = e.key
+	}
+	return unflatten(keys)
+}
+
+// (map-for-each f m)
+//
+// Calls (f key value) for every entry of m, in the order of map-keys.
+func builtinMapForEach(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	for _, e := range mapArg(ss[1]).sorted() {
+		apply(sc, ss[0], []sexpr{e.key, e.val})
+	}
+	return Nil
+}
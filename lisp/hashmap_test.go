@@ -0,0 +1,94 @@
+package lisp
+
+import (
+	"reflect"
+	"testing"
+)
+
+var hashMapTests = []struct {
+	src  string
+	want string
+}{
+	{`{}`, `{}`},
+	{`'{b 2 "a" 1 3/2 x}`, `{"a" 1 3/2 x b 2}`},
+	{`{"a" (+ 1 2) 'b nil}`, `{"a" 3 b nil}`},
+	{`(map-get '{a 1} 'a)`, `1`},
+	{`(map-get '{a 1} 'b)`, `nil`},
+	{`(map-get '{a 1} 'b 0)`, `0`},
+	{`(map-get '{1 one} 1.0)`, `nil`},
+	{`(map-get '{18446744073709551616 big} (* 4294967296 4294967296))`,
+		`big`},
+	{`(let ((f (lambda () {})))
+		(begin (map-set! (f) 1 2) (f)))`, `{}`},
+	{`(let ((m (make-map 'a 1)))
+		(begin (map-set! m 'b 2) (map-delete! m 'a) m))`, `{b 2}`},
+	{`(map-keys (make-map 'c 3 'a 1 'b 2))`, `(a b c)`},
+	{`(map-get (make-map '(a (1)) 'found) (list 'a (list 1)))`, `found`},
+	{`(map-count '{a 1 b 2})`, `2`},
+	{`(let ((m (make-map)))
+		(begin
+			(map-for-each (lambda (k v) (map-set! m v k)) '{a 1 b 2})
+			m))`, `{1 a 2 b}`},
+	{`(equal? '{a 1 b {c 2}} '{b {c 2} a 1})`, `true`},
+	{`(equal? '{a 1} '{a 2})`, `nil`},
+	{`(let ((n 0))
+		(let ((next (lambda () (begin (define n (+ n 1)) n))))
+			(list {(next) 'a (next) 'b} n)))`, `({1 a 2 b} 2)`},
+	{`(let ((log '()))
+		(let ((note (lambda (x) (begin (define log (cons x log)) x))))
+			(begin {(note 2) (note 3) (note 1) (note 0)} log)))`, `(0 1 3 2)`},
+	{`{'a 1 'a 2}`, `{a 2}`},
+	{`'{a 1 a 2}`, `{a 2}`},
+	{`(let ((m '{:a 1})) (begin (map-set! m :b 2) (eval m)))`, `{:a 1 :b 2}`},
+	{`(map? {})`, `true`},
+	{`(map? '())`, `false`},
+	{`(go.sum {"x" 1 "y" 2})`, `3`},
+	{`(go.counts)`, `{"a" 1 "b" 2}`},
+	{`(go.any)`, `{"n" 1 "s" "x" "z" nil}`},
+}
+
+func TestHashMap(t *testing.T) {
+	in := New()
+	in.Define("go.sum", func(m map[string]int) int {
+		sum := 0
+		for _, n := range m {
+			sum += n
+		}
+		return sum
+	})
+	in.Define("go.counts", func() map[string]uint8 {
+		return map[string]uint8{"a": 1, "b": 2}
+	})
+	in.Define("go.any", func() map[string]interface{} {
+		return map[string]interface{}{"n": 1, "s": "x", "z": nil}
+	})
+	for _, test := range hashMapTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestHashMapToGo(t *testing.T) {
+	in := New()
+	var got map[string]interface{}
+	in.Define("go.take", func(m map[string]interface{}) { got = m })
+	mustEval(t, in, `(go.take {"a" 1 "b" "x" "c" nil})`)
+	want := map[string]interface{}{"a": int64(1), "b": "x", "c": nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestHashMapErrors(t *testing.T) {
+	in := New()
+	for _, src := range []string{
+		`(make-map 'a)`, `(map-get '(a) 'a)`, `(map-set! (make-map) print 1)`,
+		`{a}`, `}`, `{a 1`,
+	} {
+		if _, err := in.Eval(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
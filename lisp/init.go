@@ -2,10 +2,13 @@ package lisp
 
 var init_lisp = `; Kakapo interpreter initialization file
 
-(define len (lambda (ls)
+(define -len (lambda (ls n)
   (if (equal? ls nil)
-    0
-    (+ 1 (len (cdr ls))))))
+    n
+    (-len (cdr ls) (+ n 1)))))
+
+(define len (lambda (ls)
+  (-len ls 0)))
 
 (define map
   (lambda (f ls)
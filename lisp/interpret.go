@@ -4,31 +4,201 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
 	"strings"
 )
 
-func load(s string) {
-	EvalFrom(strings.NewReader(s))
+// An Interpreter is an isolated Lisp environment. Each Interpreter has its
+// own namespaces and its own table of importable Go packages, so several of
+// them may be used side by side without affecting one another.
+type Interpreter struct {
+	imports map[string]map[string]interface{}
+
+	// The namespaces of the interpreter by name. core holds the builtins and
+	// the definitions of init.lisp, and ns is the namespace that top-level
+	// forms are evaluated in, which is user to begin with.
+	namespaces map[sym]*namespace
+	core       *namespace
+	ns         *namespace
+
+	// Whether lambdas are compiled for the VM rather than interpreted by
+	// eval.
+	compile bool
+
+	// Counts the definitions that bind a macro or primitive, or replace
+	// one, so that code compiled with the old binding can be recompiled.
+	syntaxGen uint64
+
+	// Whether a non-nil error returned by a Go function panics.
+	goErrors bool
+
+	// The number of symbols made by gensym.
+	gensyms uint64
+
+	// The modules loaded by require, by the absolute paths of their files.
+	modules map[string]*module
+
+	// The file being evaluated by ExecFile, which require looks for modules
+	// relative to.
+	file string
 }
 
-// TODO: Rename this ExecFrom
-func EvalFrom(ior io.Reader) {
-	// TODO parse and eval in separate goroutines
+// The interpreter used by EvalFrom, EvalStr, ExposeGlobal and ExposeImport.
+var defaultInterpreter *Interpreter
+
+func init() {
+	defaultInterpreter = New()
+}
+
+// New creates an Interpreter with the builtins and the contents of init.lisp
+// defined in its core namespace, which is then protected from being
+// redefined. Evaluation starts in the namespace user.
+func New() *Interpreter {
+	in := new(Interpreter)
+	in.imports = make(map[string]map[string]interface{})
+	in.modules = make(map[string]*module)
+	in.compile = true
+	in.namespaces = make(map[sym]*namespace)
+	in.core = &namespace{name: "core"}
+	in.core.sc = &scope{data: builtinData(), interp: in, ns: in.core}
+	in.namespaces[in.core.name] = in.core
 
-	r := bufio.NewReader(ior)
-	e, err := parse(r)
-	for err == nil {
-		eval(global, e)
-		e, err = parse(r)
+	// Now interpret init_lisp
+	in.ns = in.core
+	in.load(init_lisp)
+	in.core.protected = true
+	in.ns = in.namespace("user")
+	return in
+}
+
+func (in *Interpreter) load(s string) {
+	if err := in.Exec(strings.NewReader(s)); err != nil {
+		panic(err)
 	}
 }
 
-func EvalStr(s string) sexpr {
-	r := bufio.NewReader(strings.NewReader(s))
-	e, err := parse(r)
+// Exec reads s-expressions from ior and evaluates them one after another in
+// the current namespace of in. It stops at the first form that fails to read or
+// evaluate and returns the failure as an *Error.
+func (in *Interpreter) Exec(ior io.Reader) error {
+	return in.exec("", ior)
+}
+
+// ExecFile evaluates the contents of the file at path, like Exec. Errors
+// refer to the file by path.
+func (in *Interpreter) ExecFile(path string) error {
+	f, err := os.Open(path)
 	if err != nil {
-		panic(fmt.Sprint("Failed to evaluate", s))
+		return err
 	}
-	return eval(global, e)
+	defer f.Close()
+	defer func(file string) { in.file = file }(in.file)
+	in.file = path
+	return in.exec(path, f)
+}
+
+// exec evaluates the contents of ior, naming it file in source positions.
+func (in *Interpreter) exec(file string, ior io.Reader) error {
+	return in.execIn(nil, file, ior)
 }
 
+// execIn is like exec, but evaluates the contents of ior in sc, or in the
+// current namespace if sc is nil.
+func (in *Interpreter) execIn(sc *scope, file string, ior io.Reader) error {
+	// TODO parse and eval in separate goroutines
+
+	r := newPosReader(file, bufio.NewReader(ior))
+	for {
+		e, err := read(r)
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		top := sc
+		if top == nil {
+			top = in.ns.sc
+		}
+		if _, err := evalTop(top, e); err != nil {
+			return err
+		}
+	}
+}
+
+// Eval evaluates the first s-expression in s and returns its value. A failure
+// to read or evaluate s is returned as an *Error.
+func (in *Interpreter) Eval(s string) (Value, error) {
+	r := newPosReader("", bufio.NewReader(strings.NewReader(s)))
+	e, err := read(r)
+	if err == io.EOF {
+		return nil, &Error{Value: fmt.Sprint("Failed to evaluate ", s)}
+	} else if err != nil {
+		return nil, err
+	}
+	return evalTop(in.ns.sc, e)
+}
+
+// evalTop evaluates the top-level form e in sc, converting any panic to an
+// *Error.
+func evalTop(sc *scope, e sexpr) (v Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = wrapError(r, e)
+		}
+	}()
+	return eval(sc, e), nil
+}
+
+// read parses the next s-expression from r. It returns io.EOF once r is
+// exhausted and an *Error if the input is malformed.
+func read(rs io.RuneScanner) (e sexpr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r == io.EOF {
+				// EOF in the middle of a list
+				r = "Unexpected EOF"
+			}
+			err = &Error{Value: r, Pos: tokenPos(rs)}
+		}
+	}()
+	e, err = parse(rs)
+	if err != nil && err != io.EOF {
+		err = &Error{Value: err}
+	}
+	return
+}
+
+// Define binds id to the Go value x in the core namespace of in, making it
+// visible from every namespace.
+func (in *Interpreter) Define(id string, x interface{}) {
+	in.core.sc.set(sym(id), wrapGo(x))
+}
+
+// Import makes the package pkg available to in under the import path name.
+func (in *Interpreter) Import(name string, pkg map[string]interface{}) {
+	in.imports[name] = pkg
+}
+
+// PanicOnGoError sets whether a Go function called from Lisp whose last
+// result is an error panics with the error, rather than returning it, when it
+// is not nil. recover can catch the panic. While this is on, the error result
+// is dropped from the values a Go function returns.
+func (in *Interpreter) PanicOnGoError(on bool) {
+	in.goErrors = on
+}
+
+// EvalFrom evaluates every s-expression read from ior in the default
+// interpreter.
+func EvalFrom(ior io.Reader) error {
+	return defaultInterpreter.Exec(ior)
+}
+
+// EvalFile evaluates the file at path in the default interpreter.
+func EvalFile(path string) error {
+	return defaultInterpreter.ExecFile(path)
+}
+
+// EvalStr evaluates s in the default interpreter.
+func EvalStr(s string) (Value, error) {
+	return defaultInterpreter.Eval(s)
+}
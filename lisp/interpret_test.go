@@ -0,0 +1,225 @@
+package lisp
+
+import (
+	"strings"
+	"testing"
+)
+
+// mustEval evaluates s in in, failing the test if evaluation fails.
+func mustEval(t *testing.T, in *Interpreter, s string) Value {
+	v, err := in.Eval(s)
+	if err != nil {
+		t.Fatalf("%s: %s", s, err)
+	}
+	return v
+}
+
+func TestInterpreterIsolation(t *testing.T) {
+	a := New()
+	b := New()
+	a.Exec(strings.NewReader("(define x 1)"))
+	b.Exec(strings.NewReader("(define x 2)"))
+	if v := mustEval(t, a, "x"); v != int64(1) {
+		t.Errorf("x in a = %s, want 1", asString(v))
+	}
+	if v := mustEval(t, b, "x"); v != int64(2) {
+		t.Errorf("x in b = %s, want 2", asString(v))
+	}
+	if defaultInterpreter.ns.sc.isDefined("x") {
+		t.Error("x leaked into the default interpreter")
+	}
+}
+
+func TestInterpreterDefine(t *testing.T) {
+	in := New()
+	in.Define("answer", 42)
+	if v := mustEval(t, in, "(+ answer 1)"); v != int64(43) {
+		t.Errorf("(+ answer 1) = %s, want 43", asString(v))
+	}
+}
+
+func TestInterpreterImport(t *testing.T) {
+	a := New()
+	b := New()
+	a.Import("strings", map[string]interface{}{"ToUpper": strings.ToUpper})
+	mustEval(t, a, `(import "strings")`)
+	if v := mustEval(t, a, `(strings.ToUpper "abc")`); v != "ABC" {
+		t.Errorf(`(strings.ToUpper "abc") = %s, want "ABC"`, asString(v))
+	}
+	if _, found := b.imports["strings"]; found {
+		t.Error("strings was importable from another interpreter")
+	}
+}
+
+func TestEvalError(t *testing.T) {
+	in := New()
+	_, err := in.Eval("(+ 1 (car 5))")
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %#v, want an *Error", err)
+	}
+	if e.Value != "Invalid argument" {
+		t.Errorf("Value = %#v, want \"Invalid argument\"", e.Value)
+	}
+	if s := asString(e.Form); s != "(car 5)" {
+		t.Errorf("Form = %s, want (car 5)", s)
+	}
+}
+
+func TestBacktrace(t *testing.T) {
+	in := New()
+	in.Exec(strings.NewReader(`
+		(define g (lambda (x) (car x)))
+		(define f (lambda (x) (+ 1 (g x))))`))
+	_, err := in.Eval("(f 5)")
+	e, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("got %#v, want an *Error", err)
+	}
+	want := []struct{ name, form string }{
+		{"g", "(car x)"},
+		{"f", "(g x)"},
+		{"", "(f 5)"},
+	}
+	if len(e.Backtrace) != len(want) {
+		t.Fatalf("Backtrace = %v, want %v", e.Backtrace, want)
+	}
+	for i, f := range e.Backtrace {
+		if f.Name != want[i].name || asString(f.Form) != want[i].form {
+			t.Errorf("Backtrace[%d] = %s, want %v", i, f, want[i])
+		}
+	}
+
+	_, err = in.Eval("((lambda (x) (car x)) 1)")
+	if name := err.(*Error).Backtrace[0].Name; name != "lambda" {
+		t.Errorf("anonymous function named %q, want \"lambda\"", name)
+	}
+}
+
+func TestBacktraceBuiltin(t *testing.T) {
+	in := New()
+	in.Exec(strings.NewReader(`(define f (lambda (x) (car x)))`))
+	v := mustEval(t, in, `(recover '(_)
+		(lambda () (f 1))
+		(lambda (e err) (backtrace err)))`)
+	frames := flatten(v)
+	if len(frames) != 1 || frames[0] != "f: (car x) at 1:23" {
+		t.Errorf("(backtrace err) = %s", asString(v))
+	}
+	if _, err := in.Eval("(backtrace 'x)"); err == nil {
+		t.Error("(backtrace 'x) did not fail")
+	}
+}
+
+// The error given to a handler can be passed on to the functions it calls.
+func TestBacktraceHelper(t *testing.T) {
+	in := New()
+	in.Exec(strings.NewReader(`(define f (lambda (x) (car x)))
+(define show (lambda (err) (backtrace err)))`))
+	v := mustEval(t, in, `(recover '(_)
+		(lambda () (f 1))
+		(lambda (e err) (show err)))`)
+	frames := flatten(v)
+	if len(frames) != 1 || frames[0] != "f: (car x) at 1:23" {
+		t.Errorf("(show err) = %s", asString(v))
+	}
+}
+
+// Handlers running at the same time in different goroutines each see the
+// backtrace of their own error. The handlers both take their backtraces
+// between meeting on a and on b.
+func TestBacktraceGoroutines(t *testing.T) {
+	in := New()
+	err := in.Exec(strings.NewReader(`
+		(define a (chan))
+		(define b (chan))
+		(define out (chan))
+		(go (recover '(_)
+			(lambda () (car 'x))
+			(lambda (e err) (begin
+				(<- a 1)
+				(let ((bt (backtrace err))) (begin (<- b 1) (<- out bt)))))))
+		(go (recover '(_)
+			(lambda () (cdr 'y))
+			(lambda (e err) (begin
+				(<- a)
+				(let ((bt (backtrace err))) (begin (<- b) (<- out bt)))))))`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		v := mustEval(t, in, `(<- out)`)
+		got[asString(flatten(v)[0])] = true
+	}
+	for _, want := range []string{`"lambda: (car (quote x)) at 6:15"`,
+		`"lambda: (cdr (quote y)) at 11:15"`} {
+		if !got[want] {
+			t.Errorf("no handler got the backtrace %s; got %v", want, got)
+		}
+	}
+}
+
+func TestEvalPanicValue(t *testing.T) {
+	in := New()
+	_, err := in.Eval("(panic 'boom)")
+	if e, ok := err.(*Error); !ok || e.Value != sym("boom") {
+		t.Errorf("got %#v, want an *Error with value boom", err)
+	}
+	_, err = in.Eval("undefined-symbol")
+	if err == nil {
+		t.Error("undefined symbol did not fail")
+	}
+}
+
+func TestRecoverUnwrapsError(t *testing.T) {
+	in := New()
+	v := mustEval(t, in, `(recover '(boom)
+		(lambda () (car (panic 'boom)))
+		(lambda (e) e))`)
+	if v != sym("boom") {
+		t.Errorf("recovered %s, want boom", asString(v))
+	}
+}
+
+func TestExecError(t *testing.T) {
+	in := New()
+	err := in.Exec(strings.NewReader("(define y 1) (car y) (define y 2)"))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if v := mustEval(t, in, "y"); v != int64(1) {
+		t.Errorf("Exec continued after an error: y = %s", asString(v))
+	}
+	err = in.Exec(strings.NewReader("(+ 1 2"))
+	if e, ok := err.(*Error); !ok || e.Value != "Unexpected EOF" {
+		t.Errorf("got %#v, want an Unexpected EOF error", err)
+	}
+}
+
+func TestErrorPosition(t *testing.T) {
+	in := New()
+	src := "(define f\n  (lambda (x)\n    (car x)))\n(f 1)\n"
+	err := in.exec("test.lisp", strings.NewReader(src))
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	want := "test.lisp:3:5: Invalid argument in (car x)"
+	if err.Error() != want {
+		t.Errorf("got %q, want %q", err.Error(), want)
+	}
+	e := err.(*Error)
+	last := e.Backtrace[len(e.Backtrace)-1]
+	if last.Pos == nil || *last.Pos != (Pos{"test.lisp", 4, 1}) {
+		t.Errorf("outermost frame at %v, want test.lisp:4:1", last.Pos)
+	}
+}
+
+func TestReadErrorPosition(t *testing.T) {
+	in := New()
+	err := in.exec("bad.lisp", strings.NewReader("(+ 1 2)\n  )"))
+	want := "bad.lisp:2:3: Unmatched ')'"
+	if err == nil || err.Error() != want {
+		t.Errorf("got %v, want %q", err, want)
+	}
+}
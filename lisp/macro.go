@@ -1,39 +1,303 @@
 package lisp
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
+// A macro transforms the unevaluated forms it is applied to into a form that
+// is evaluated in place of the application.
 type macro struct {
-	name sym
-	argNames []sym
-	body sexpr
+	name      sym
+	transform func(name sym, args []sexpr) sexpr
 }
 
 func (m macro) expand(args []sexpr) sexpr {
-	if len(args) != len(m.argNames) {
-		pattern := ("Wrong number of arguments to %s macro. " +
-			"Expected %d args, got %d")
-		msg := fmt.Sprintf(pattern, m.name, len(m.argNames), len(args))
-		panic(msg)
+	return m.transform(m.name, args)
+}
+
+// lambdaMacro returns the macro defined by defmacro with the lambda list
+// params and the body body, in the scope env.
+func lambdaMacro(name sym, params, body sexpr, env *scope) macro {
+	ll := parseLambdaList(params)
+	return macro{name: name, transform: func(name sym, args []sexpr) sexpr {
+		sc := newScope(env)
+		call := cons{car: name, cdr: unflatten(args)}
+		ll.bind(sc, call.cdr, call, ll)
+		return eval(sc, body)
+	}}
+}
+
+// A lambdaList is the parsed parameter list of a macro:
+//
+//	(required... [&optional opt...] [&rest rest] [&key key...])
+//
+// A required parameter is a symbol or a nested lambda list that destructures
+// the form it is given. opt and key are a symbol or (symbol default), where
+// default is evaluated when no form is given for the parameter. A dotted
+// tail, or &body, may be used in place of &rest. A key parameter named x is
+// given the form that follows :x among the forms after the optional ones.
+type lambdaList struct {
+	required []sexpr // sym or *lambdaList
+	optional []param
+	rest     sym // "" if there is no rest parameter
+	keys     []param
+	hasKeys  bool
+	params   sexpr // the lambda list as written
+}
+
+type param struct {
+	name sym
+	def  sexpr
+}
+
+// The parts of a lambda list, in the order they must appear.
+const (
+	requiredParams = iota
+	optionalParams
+	restParam
+	keyParams
+)
+
+// parseLambdaList returns the lambda list params, panicking if it is not a
+// valid one.
+func parseLambdaList(params sexpr) *lambdaList {
+	ll := &lambdaList{params: params}
+	part := requiredParams
+	for params != nil {
+		c, ok := params.(cons)
+		if !ok {
+			s, ok := params.(sym)
+			if !ok {
+				panic(fmt.Sprintf("Expected a symbol, got %s", asString(params)))
+			}
+			if part >= restParam {
+				panic(fmt.Sprintf("Misplaced rest parameter %s", s))
+			}
+			ll.rest = s
+			return ll
+		}
+		params = c.cdr
+		switch c.car {
+		case sym("&optional"):
+			if part >= optionalParams {
+				panic("Misplaced &optional in lambda list")
+			}
+			part = optionalParams
+			continue
+		case sym("&rest"), sym("&body"):
+			if part >= restParam {
+				panic(fmt.Sprintf("Misplaced %s in lambda list", c.car))
+			}
+			next, ok := params.(cons)
+			s, isSym := next.car.(sym)
+			if !ok || !isSym {
+				panic(fmt.Sprintf("Expected a symbol after %s", c.car))
+			}
+			ll.rest = s
+			params = next.cdr
+			part = restParam
+			continue
+		case sym("&key"):
+			if part >= keyParams {
+				panic("Misplaced &key in lambda list")
+			}
+			ll.hasKeys = true
+			part = keyParams
+			continue
+		}
+		switch part {
+		case requiredParams:
+			switch p := c.car.(type) {
+			case sym:
+				ll.required = append(ll.required, p)
+			case nil, cons:
+				ll.required = append(ll.required, parseLambdaList(p))
+			default:
+				panic(fmt.Sprintf("Expected a symbol, got %s", asString(p)))
+			}
+		case optionalParams:
+			ll.optional = append(ll.optional, parseParam(c.car))
+		case restParam:
+			panic(fmt.Sprintf("Misplaced parameter %s after rest parameter",
+				asString(c.car)))
+		case keyParams:
+			ll.keys = append(ll.keys, parseParam(c.car))
+		}
+	}
+	return ll
+}
+
+// parseParam returns the optional or key parameter p, which is a symbol or a
+// list of a symbol and its default.
+func parseParam(p sexpr) param {
+	if s, ok := p.(sym); ok {
+		return param{name: s, def: Nil}
+	}
+	items, ok := listItems(p)
+	if ok && (len(items) == 1 || len(items) == 2) {
+		if s, ok := items[0].(sym); ok {
+			def := sexpr(Nil)
+			if len(items) == 2 {
+				def = items[1]
+			}
+			return param{name: s, def: def}
+		}
+	}
+	panic(fmt.Sprintf("Invalid parameter %s", asString(p)))
+}
+
+// macroError returns msg as an error in call, the application of a macro, to
+// panic with, so that the error shows call however the macro came to be
+// expanded.
+func macroError(call cons, msg string) *Error {
+	return &Error{Value: msg, Form: call}
+}
+
+// bind defines the parameters of ll in sc as the parts of the forms args
+// they correspond to, panicking if args does not fit ll. call is the
+// application of the macro, and top its whole lambda list, of which ll may
+// be a nested part.
+func (ll *lambdaList) bind(sc *scope, args sexpr, call cons, top *lambdaList) {
+	mismatch := func() {
+		if ll == top {
+			forms, _ := listItems(call.cdr)
+			panic(macroError(call, fmt.Sprintf("Wrong number of arguments "+
+				"to %s macro. Expected %s args, got %d", call.car,
+				ll.arity(), len(forms))))
+		}
+		panic(macroError(call, fmt.Sprintf(
+			"Arguments to %s macro do not match %s", call.car,
+			asString(top.params))))
+	}
+	for _, p := range ll.required {
+		c, ok := args.(cons)
+		if !ok {
+			mismatch()
+		}
+		if nested, ok := p.(*lambdaList); ok {
+			nested.bind(sc, c.car, call, top)
+		} else {
+			sc.define(p.(sym), c.car)
+		}
+		args = c.cdr
+	}
+	for _, p := range ll.optional {
+		if c, ok := args.(cons); ok {
+			sc.define(p.name, c.car)
+			args = c.cdr
+		} else if args == nil {
+			sc.define(p.name, eval(sc, p.def))
+		} else {
+			mismatch()
+		}
+	}
+	if ll.rest != "" {
+		sc.define(ll.rest, args)
+	}
+	if !ll.hasKeys {
+		if args != nil && ll.rest == "" {
+			mismatch()
+		}
+		return
 	}
-	newBody := m.body
-	for i, argName := range(m.argNames) {
-		arg := args[i]
-		newBody = replaceSym(argName, arg, newBody)
+	items, ok := listItems(args)
+	if !ok {
+		mismatch()
+	}
+	given := make(map[sym]sexpr)
+	for i := 0; i < len(items); i += 2 {
+		k, ok := items[i].(keyword)
+		if !ok || !ll.hasKey(sym(k)) {
+			panic(macroError(call, fmt.Sprintf(
+				"Invalid keyword argument %s to %s macro",
+				asString(items[i]), call.car)))
+		}
+		if i+1 == len(items) {
+			panic(macroError(call,
+				fmt.Sprintf("Missing value for %s", asString(k))))
+		}
+		if _, ok := given[sym(k)]; !ok {
+			given[sym(k)] = items[i+1]
+		}
+	}
+	for _, p := range ll.keys {
+		if v, ok := given[p.name]; ok {
+			sc.define(p.name, v)
+		} else {
+			sc.define(p.name, eval(sc, p.def))
+		}
+	}
+}
+
+func (ll *lambdaList) hasKey(name sym) bool {
+	for _, p := range ll.keys {
+		if p.name == name {
+			return true
+		}
 	}
-	return newBody
+	return false
 }
 
-// replaceSym(s, val, e) replaces s with val in e.
-func replaceSym(s sym, val sexpr, e sexpr) sexpr {
-	if e == s {
-		return val
+// names appends the symbols that ll binds to names.
+func (ll *lambdaList) names(names []sexpr) []sexpr {
+	for _, p := range ll.required {
+		if nested, ok := p.(*lambdaList); ok {
+			names = nested.names(names)
+		} else {
+			names = append(names, p)
+		}
 	}
-	switch e2 := e.(type) {
-	case cons:
-		newCar := replaceSym(s, val, e2.car)
-		newCdr := replaceSym(s, val, e2.cdr)
-		return cons{newCar, newCdr}
+	for _, p := range ll.optional {
+		names = append(names, p.name)
 	}
-	return e
+	if ll.rest != "" {
+		names = append(names, ll.rest)
+	}
+	for _, p := range ll.keys {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+// arity describes the number of forms that ll takes, as in "2", "1 to 3" or
+// "at least 1".
+func (ll *lambdaList) arity() string {
+	required := len(ll.required)
+	switch {
+	case ll.rest != "" || ll.hasKeys:
+		return fmt.Sprintf("at least %d", required)
+	case len(ll.optional) > 0:
+		return fmt.Sprintf("%d to %d", required, required+len(ll.optional))
+	}
+	return fmt.Sprint(required)
 }
 
+// gensym returns a new symbol, distinct from those returned before and from
+// any that the reader produces in practice, named after prefix.
+func (in *Interpreter) gensym(prefix string) sym {
+	n := atomic.AddUint64(&in.gensyms, 1)
+	return sym(fmt.Sprintf("#:%s%d", prefix, n))
+}
+
+// (gensym [prefix])
+//
+// Returns a new symbol for a macro to name a variable of the code it
+// produces with, so that it cannot capture a variable of the code the macro
+// is applied to.
+func builtinGensym(sc *scope, ss []sexpr) sexpr {
+	prefix := "g"
+	if len(ss) == 1 {
+		switch p := ss[0].(type) {
+		case string:
+			prefix = p
+		case sym:
+			prefix = string(p)
+		default:
+			panic("Invalid argument")
+		}
+	} else if len(ss) > 1 {
+		panic("Invalid number of arguments")
+	}
+	return sc.interp.gensym(prefix)
+}
@@ -0,0 +1,183 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+var macroTests = []struct {
+	defs string
+	src  string
+	want string
+}{
+	{`(defmacro sq (x) (list '* x x))`, `(sq 3)`, `9`},
+	{`(defmacro tag (x) (list 'list ''x x))`, `(tag 5)`, `(x 5)`},
+	{`(defmacro const (x) (list 'lambda '(x) x))`, `((const 1) 2)`, `1`},
+	{`(defmacro my-list xs (cons 'list xs))`, `(my-list 1 2 3)`, `(1 2 3)`},
+	{`(defmacro when (c . body) (list 'if c (cons 'begin body) nil))`,
+		`(when true 1 2)`, `2`},
+	{`(defmacro let1 ((name val) body)
+		(list (list 'lambda (list name) body) val))`,
+		`(let1 (x 2) (* x 3))`, `6`},
+	{`(defmacro swap! (a b)
+		(let ((tmp (gensym)))
+			` + "`" + `(let ((,tmp ,a)) (begin (define ,a ,b) (define ,b ,tmp)))))
+	  (define tmp 1)
+	  (define y 2)
+	  (swap! tmp y)`,
+		`(list tmp y)`, `(2 1)`},
+	{``, `(equal? (gensym) (gensym))`, `nil`},
+	{``, `(gensym 'x)`, `#:x1`},
+
+	{`(defmacro when (c &body body) (list 'if c (cons 'begin body) nil))`,
+		`(when true 1 2)`, `2`},
+	{`(defmacro my-list (&rest xs) (cons 'list xs))`, `(my-list 1 2 3)`, `(1 2 3)`},
+	{`(defmacro inc (x &optional (n 1)) (list '+ x n))`,
+		`(list (inc 1) (inc 1 5))`, `(2 6)`},
+	{`(defmacro range (a &optional (b (+ a 1))) (list 'list a b))`,
+		`(range 3)`, `(3 4)`},
+	{`(defmacro opt (&optional a) (list 'quote a))`, `(opt)`, `nil`},
+	{`(defmacro seq (n &key (from 0) (by 1)) (list 'list n from by))`,
+		`(list (seq 5) (seq 5 :by 2) (seq 5 :by 2 :from 1 :by 3))`,
+		`((5 0 1) (5 0 2) (5 1 2))`},
+	{`(defmacro tagged (name &rest body &key tag) (list 'quote (list name tag body)))`,
+		`(tagged x :tag t)`, `(x t (:tag t))`},
+	{`(defmacro dolist ((var lst &optional result) &body body)
+		` + "`" + `(begin (map (lambda (,var) ,@body) ,lst) ,result))`,
+		`(list (dolist (x '(1 2)) x) (dolist (x '(1 2) 'done) x))`, `(nil done)`},
+
+	{`(define-syntax swap!
+		(syntax-rules ()
+			((_ a b) (let ((tmp a)) (begin (define a b) (define b tmp))))))
+	  (define tmp 1)
+	  (define y 2)
+	  (swap! tmp y)`,
+		`(list tmp y)`, `(2 1)`},
+	{`(define-syntax my-or
+		(syntax-rules ()
+			((_) nil)
+			((_ e) e)
+			((_ e r ...) (let ((t e)) (if t t (my-or r ...))))))
+	  (define t 5)`,
+		`(list (my-or) (my-or nil t) (let ((t 7)) (my-or nil nil t)))`,
+		`(nil 5 7)`},
+	{`(define-syntax my-let*
+		(syntax-rules ()
+			((_ () body) body)
+			((_ ((x v) rest ...) body) (let ((x v)) (my-let* (rest ...) body)))))`,
+		`(my-let* ((a 1) (b (+ a 1))) (list a b))`, `(1 2)`},
+	{`(define-syntax for-each-in
+		(syntax-rules (in)
+			((_ x in (item ...) body) (list (let ((x item)) body) ...))))`,
+		`(for-each-in n in (1 2 3) (* n n))`, `(1 4 9)`},
+	{`(define-syntax pairs
+		(syntax-rules ()
+			((_ (k v) ...) [(cons 'k v) ...])))`,
+		`(pairs (a 1) (b 2))`, `[(a . 1) (b . 2)]`},
+	{`(define-syntax tag (syntax-rules () ((_ x) (list 'hello x))))`,
+		`(tag 1)`, `(hello 1)`},
+	{`(define-syntax named (syntax-rules () ((_ x) (let ((tmp x)) (list 'tmp tmp)))))`,
+		`(named 5)`, `(tmp 5)`},
+	{`(define-syntax qq (syntax-rules () ((_ x) ` + "`" + `(hello ,x ,(list 'a x) ,@(list x)))))`,
+		`(qq 1)`, `(hello 1 (a 1) 1)`},
+	{`(define-syntax second
+		(syntax-rules () ((_ a b . rest) b)))`,
+		`(second 1 2 3 4)`, `2`},
+}
+
+func TestMacros(t *testing.T) {
+	for _, test := range macroTests {
+		in := New()
+		if err := in.Exec(strings.NewReader(test.defs)); err != nil {
+			t.Errorf("%s: %v", test.defs, err)
+			continue
+		}
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestMacroErrors(t *testing.T) {
+	defs := `
+		(defmacro sq (x) (list '* x x))
+		(defmacro when (c . body) (list 'if c (cons 'begin body) nil))
+		(defmacro let1 ((name val) body) body)
+		(defmacro inc (x &optional (n 1)) (list '+ x n))
+		(defmacro opts (x &key by to) (list x by to))
+		(define-syntax two (syntax-rules () ((_ a b) (list a b))))
+		(define-syntax bad (syntax-rules () ((_ a) (list a ...))))`
+	tests := []struct {
+		src, want string
+	}{
+		{`(sq 1 2)`, `Wrong number of arguments to sq macro. Expected 1 args, got 2`},
+		{`(when)`,
+			`Wrong number of arguments to when macro. Expected at least 1 args, got 0`},
+		{`(inc)`,
+			`Wrong number of arguments to inc macro. Expected 1 to 2 args, got 0`},
+		{`(inc x 1 2)`,
+			`Wrong number of arguments to inc macro. Expected 1 to 2 args, got 3`},
+		{`(let1 x 1)`, `Arguments to let1 macro do not match ((name val) body)`},
+		{`(opts 1 :by 2 :to)`, `Missing value for :to`},
+		{`(opts 1 :step 2)`, `Invalid keyword argument :step to opts macro`},
+		{`(opts 1 2)`, `Invalid keyword argument 2 to opts macro`},
+		{`(defmacro m (1) 1)`, `Expected a symbol, got 1`},
+		{`(defmacro m (&rest) 1)`, `Expected a symbol after &rest`},
+		{`(defmacro m (&rest a b) 1)`, `Misplaced parameter b after rest parameter`},
+		{`(defmacro m (&key a &optional b) 1)`, `Misplaced &optional in lambda list`},
+		{`(defmacro m (&rest a . b) 1)`, `Misplaced rest parameter b`},
+		{`(defmacro m (&optional (a 1 2)) 1)`, `Invalid parameter (a 1 2)`},
+		{`(two 1)`, `No rule of two macro matches its arguments`},
+		{`(bad 1)`, `No pattern variable to repeat in a`},
+		{`(define-syntax x 1)`, `Expected a macro`},
+	}
+	for _, test := range tests {
+		in := New()
+		if err := in.Exec(strings.NewReader(defs)); err != nil {
+			t.Fatal(err)
+		}
+		_, err := in.Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
+
+// Errors in applying a macro name the application once, as the form of the
+// error, however the macro is expanded.
+func TestMacroErrorForms(t *testing.T) {
+	in := New()
+	if err := in.Exec(strings.NewReader(`
+		(defmacro m (a b) (list a b))
+		(defmacro opts (&key by) by)
+		(define-syntax two (syntax-rules () ((_ a b) (list a b))))`)); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src, want string
+	}{
+		{`(m 1)`,
+			`1:1: Wrong number of arguments to m macro. Expected 2 args, got 1 in (m 1)`},
+		{`(list (m 1))`,
+			`1:7: Wrong number of arguments to m macro. Expected 2 args, got 1 in (m 1)`},
+		{`(macroexpand '(m 1))`,
+			`1:1: Wrong number of arguments to m macro. Expected 2 args, got 1 in (m 1)`},
+		{`(opts :to 1)`, `1:1: Invalid keyword argument :to to opts macro in (opts :to 1)`},
+		{`(macroexpand '(two 1))`,
+			`1:1: No rule of two macro matches its arguments in (two 1)`},
+	}
+	for _, test := range tests {
+		_, err := in.Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+		} else if msg := err.Error(); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
@@ -1,175 +1,111 @@
 package lisp
 
+import (
+	"math"
+	"math/big"
+)
+
 func builtinAdd(sc *scope, ss []sexpr) sexpr {
 	// add all numeric arguments
-	r := 0.
+	var r sexpr = int64(0)
 	for _, s := range ss {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r += n
+		r = arith('+', r, s)
 	}
 	return r
 }
 
 func builtinSub(sc *scope, ss []sexpr) sexpr {
 	if len(ss) == 0 {
-		return 0
-	}
-	s := ss[0]
-	r, ok := s.(float64)
-	if !ok {
-		panic("Invalid argument")
+		return int64(0)
 	}
 	if len(ss) == 1 {
-		return -r
+		return arith('-', int64(0), ss[0])
 	}
+	r := ss[0]
 	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r -= n
+		r = arith('-', r, s)
 	}
 	return r
 }
 
 func builtinMul(sc *scope, ss []sexpr) sexpr {
-	// add all numeric arguments
-	r := 1.
+	// multiply all numeric arguments
+	var r sexpr = int64(1)
 	for _, s := range ss {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r *= n
+		r = arith('*', r, s)
 	}
 	return r
 }
 
 func builtinDiv(sc *scope, ss []sexpr) sexpr {
 	if len(ss) == 0 {
-		return 0
-	}
-	s := ss[0]
-	r, ok := s.(float64)
-	if !ok {
-		panic("Invalid argument")
+		return int64(0)
 	}
 	if len(ss) == 1 {
-		return 1 / r
+		return arith('/', int64(1), ss[0])
 	}
+	r := ss[0]
 	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r /= n
+		r = arith('/', r, s)
 	}
 	return r
 }
 
+// (% a b)
+//
+// Returns the remainder of dividing a by b, truncated towards zero like Go's
+// % operator. The remainder of floats is computed with math.Mod.
 func builtinMod(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 2 {
 		panic("Invalid number of arguments")
 	}
-	a, ok1 := ss[0].(float64)
-	b, ok2 := ss[1].(float64)
-	if !ok1 || !ok2 {
-		panic("Invalid argument")
+	a, b := ss[0], ss[1]
+	switch levels(a, b) {
+	case levelInt:
+		if b.(int64) == 0 {
+			panic("Division by zero")
+		}
+		return a.(int64) % b.(int64)
+	case levelBig:
+		y := toBig(b)
+		if y.Sign() == 0 {
+			panic("Division by zero")
+		}
+		return normBig(new(big.Int).Rem(toBig(a), y))
+	case levelFloat:
+		return math.Mod(toFloat(a), toFloat(b))
 	}
-	return int(a) % int(b) // TODO fixme to work with floats
+	panic("Invalid argument")
 }
 
-func builtinGt(sc *scope, ss []sexpr) sexpr {
-	if len(ss) == 0 {
-		return 1.0
-	}
-	r := true
-	f, ok := ss[0].(float64)
-	if !ok {
-		panic("Invalid argument")
-	}
-	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
+// compareChain reports whether test holds for the comparison of every
+// argument with the next one.
+func compareChain(ss []sexpr, test func(c int) bool) sexpr {
+	for _, s := range ss {
+		if !isReal(s) {
 			panic("Invalid argument")
 		}
-		r = r && (f > n)
-		f = n
 	}
-	if r {
-		return 1.0
+	for i := 1; i < len(ss); i++ {
+		if !test(numCompare(ss[i-1], ss[i])) {
+			return Nil
+		}
 	}
-	return Nil
+	return true
+}
+
+func builtinGt(sc *scope, ss []sexpr) sexpr {
+	return compareChain(ss, func(c int) bool { return c == 1 })
 }
 
 func builtinLt(sc *scope, ss []sexpr) sexpr {
-	if len(ss) == 0 {
-		return 1.0
-	}
-	r := true
-	f, ok := ss[0].(float64)
-	if !ok {
-		panic("Invalid argument")
-	}
-	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r = r && (f < n)
-		f = n
-	}
-	if r {
-		return 1.0
-	}
-	return Nil
+	return compareChain(ss, func(c int) bool { return c == -1 })
 }
 
 func builtinGe(sc *scope, ss []sexpr) sexpr {
-	if len(ss) == 0 {
-		return 1.0
-	}
-	r := true
-	f, ok := ss[0].(float64)
-	if !ok {
-		panic("Invalid argument")
-	}
-	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r = r && (f >= n)
-		f = n
-	}
-	if r {
-		return 1.0
-	}
-	return Nil
+	return compareChain(ss, func(c int) bool { return c == 1 || c == 0 })
 }
 
 func builtinLe(sc *scope, ss []sexpr) sexpr {
-	if len(ss) == 0 {
-		return 1.0
-	}
-	r := true
-	f, ok := ss[0].(float64)
-	if !ok {
-		panic("Invalid argument")
-	}
-	for _, s := range ss[1:] {
-		n, ok := s.(float64)
-		if !ok {
-			panic("Invalid argument")
-		}
-		r = r && (f <= n)
-		f = n
-	}
-	if r {
-		return 1.0
-	}
-	return Nil
+	return compareChain(ss, func(c int) bool { return c == -1 || c == 0 })
 }
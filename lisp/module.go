@@ -0,0 +1,154 @@
+package lisp
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// A module is a Lisp source file loaded with require. It is evaluated once
+// per interpreter, in a scope of its own below the core namespace, and only
+// the symbols it names with provide are defined where it is required.
+type module struct {
+	path     string // the absolute path of the file
+	sc       *scope
+	provided []sym
+	loaded   bool
+}
+
+// moduleOf returns the module that sc belongs to, or nil if it is not part
+// of one.
+func moduleOf(sc *scope) *module {
+	for ; sc != nil; sc = sc.parent {
+		if sc.module != nil {
+			return sc.module
+		}
+	}
+	return nil
+}
+
+// findModule returns the path of the file of the module name, looking for
+// it in dir and then in the directories listed in $KAKAPO_PATH.
+func findModule(name, dir string) (string, bool) {
+	file := filepath.FromSlash(name)
+	if !strings.HasSuffix(file, ".lisp") {
+		file += ".lisp"
+	}
+	if filepath.IsAbs(file) {
+		_, err := os.Stat(file)
+		return file, err == nil
+	}
+	dirs := append([]string{dir}, filepath.SplitList(os.Getenv("KAKAPO_PATH"))...)
+	for _, d := range dirs {
+		p := filepath.Join(d, file)
+		if _, err := os.Stat(p); err == nil {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// loadModule returns the module in the file at path, evaluating the file if
+// it has not been loaded yet.
+func (in *Interpreter) loadModule(path string) *module {
+	if m, ok := in.modules[path]; ok {
+		if !m.loaded {
+			panic(fmt.Sprintf("Circular require of %s", path))
+		}
+		return m
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		panic(err)
+	}
+	defer f.Close()
+
+	m := &module{path: path}
+	m.sc = newScope(in.core.sc)
+	m.sc.module = m
+	in.modules[path] = m
+	if err := in.execIn(m.sc, path, f); err != nil {
+		delete(in.modules, path)
+		panic(err)
+	}
+	for _, s := range m.provided {
+		if !m.sc.isDefinedHere(s) {
+			delete(in.modules, path)
+			panic(fmt.Sprintf("%s provides %s, which it does not define",
+				path, s))
+		}
+	}
+	m.loaded = true
+	return m
+}
+
+// (require "name" [:as prefix])
+//
+// Loads the module name from the file name.lisp, found in the directory of
+// the file being evaluated or else in one of the directories listed in
+// $KAKAPO_PATH. The symbols the module provides are defined, as define
+// does, as prefix.symbol, where prefix defaults to the last element of name,
+// and in the namespace prefix. A module is only evaluated the first time it
+// is required.
+func primitiveRequire(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 && len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	name, ok := eval(sc, ss[0]).(string)
+	if !ok {
+		panic("Invalid argument")
+	}
+	prefix := strings.TrimSuffix(path.Base(name), ".lisp")
+	if len(ss) == 3 {
+		alias, ok := ss[2].(sym)
+		if ss[1] != keyword("as") || !ok {
+			panic("Invalid argument")
+		}
+		prefix = string(alias)
+	}
+
+	in := sc.interp
+	dir := "."
+	if m := moduleOf(sc); m != nil {
+		dir = filepath.Dir(m.path)
+	} else if in.file != "" {
+		dir = filepath.Dir(in.file)
+	}
+	file, found := findModule(name, dir)
+	if !found {
+		panic(fmt.Sprintf("Module not found: %q", name))
+	}
+	if abs, err := filepath.Abs(file); err == nil {
+		file = abs
+	}
+
+	m := in.loadModule(file)
+	ns := in.namespace(sym(prefix))
+	for _, s := range m.provided {
+		v := m.sc.lookup(s)
+		sc.defineHigh(sym(prefix+"."+string(s)), v)
+		ns.sc.define(s, v)
+	}
+	return Nil
+}
+
+// (provide sym...)
+//
+// Names the symbols that the module being loaded exports to the files that
+// require it.
+func primitiveProvide(sc *scope, ss []sexpr) sexpr {
+	m := moduleOf(sc)
+	if m == nil {
+		panic("provide used outside of a module")
+	}
+	for _, s := range ss {
+		name, ok := s.(sym)
+		if !ok {
+			panic("Invalid argument")
+		}
+		m.provided = append(m.provided, name)
+	}
+	return Nil
+}
@@ -0,0 +1,106 @@
+package lisp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeFiles creates the files in dir, with the contents given by files.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	for name, src := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(src), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	lib := t.TempDir()
+	t.Setenv("KAKAPO_PATH", lib)
+	writeFiles(t, dir, map[string]string{
+		"util/numbers.lisp": `
+			(loaded!)
+			(provide scale twice)
+			(define factor 10)
+			(define scale (lambda (x) (* x factor)))
+			(define twice (lambda (x) (+ x x)))`,
+		"main.lisp": `
+			(require "util/numbers")
+			(require "util/numbers" :as num)
+			(require "counter")
+			(define result (list (numbers.scale 2) (num.twice 3)
+				(counter.next) (counter.next)))`,
+	})
+	writeFiles(t, lib, map[string]string{
+		"counter.lisp": `
+			(provide next)
+			(define n 0)
+			(define next (lambda () (begin (define n (+ n 1)) n)))`,
+	})
+
+	in := New()
+	loads := 0
+	in.Define("loaded!", func() { loads++ })
+	if err := in.ExecFile(filepath.Join(dir, "main.lisp")); err != nil {
+		t.Fatal(err)
+	}
+	if s := asString(mustEval(t, in, "result")); s != `(20 6 1 2)` {
+		t.Errorf("result = %s", s)
+	}
+	if loads != 1 {
+		t.Errorf("util/numbers was loaded %d times", loads)
+	}
+	for _, s := range []string{"factor", "numbers.factor", "scale", "n"} {
+		if _, err := in.Eval(s); err == nil {
+			t.Errorf("%s is defined outside its module", s)
+		}
+	}
+}
+
+func TestRequireErrors(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"a.lisp":       `(require "b")`,
+		"b.lisp":       `(require "a")`,
+		"missing.lisp": `(provide f)`,
+		"broken.lisp":  `(car 1)`,
+	})
+	t.Setenv("KAKAPO_PATH", dir)
+	tests := []struct {
+		src, want string
+	}{
+		{`(require "nowhere")`, `Module not found: "nowhere"`},
+		{`(require "a")`, "Circular require of " + filepath.Join(dir, "a.lisp")},
+		{`(require "missing")`, filepath.Join(dir, "missing.lisp") +
+			" provides f, which it does not define"},
+		{`(require "broken")`, "Invalid argument"},
+		{`(require "b" :from x)`, "Invalid argument"},
+		{`(provide f)`, "provide used outside of a module"},
+	}
+	for _, test := range tests {
+		_, err := New().Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+
+	// A module that failed to load is loaded again when next required.
+	in := New()
+	in.Eval(`(require "broken")`)
+	_, err := in.Eval(`(require "broken")`)
+	if err == nil || !strings.Contains(err.Error(), "broken.lisp") {
+		t.Errorf("second require: got %v", err)
+	}
+}
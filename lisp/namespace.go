@@ -0,0 +1,120 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A namespace is a named table of definitions. Top-level forms are evaluated
+// in the current namespace, which is changed with in-ns, and the definitions
+// of another namespace are referred to as namespace/name. Every namespace
+// sees the definitions of core, the namespace of the builtins, but a
+// definition in one namespace never replaces one in another.
+type namespace struct {
+	name sym
+	sc   *scope
+
+	// Whether the namespace can no longer be defined in, as is the case for
+	// core once the interpreter is set up.
+	protected bool
+}
+
+// namespace returns the namespace called name, creating it if there is none.
+func (in *Interpreter) namespace(name sym) *namespace {
+	if ns, ok := in.namespaces[name]; ok {
+		return ns
+	}
+	ns := &namespace{name: name}
+	ns.sc = newScope(in.core.sc)
+	ns.sc.ns = ns
+	in.namespaces[name] = ns
+	return ns
+}
+
+// namespaceArg returns the existing namespace named by s, panicking if there
+// is none.
+func (in *Interpreter) namespaceArg(s sexpr) *namespace {
+	name, ok := s.(sym)
+	if !ok {
+		panic("Invalid argument")
+	}
+	ns, ok := in.namespaces[name]
+	if !ok {
+		panic(fmt.Sprintf("No namespace %s", name))
+	}
+	return ns
+}
+
+// qualified returns the value of the definition named by the qualified
+// symbol namespace/name, reporting whether there is one.
+func (in *Interpreter) qualified(sy sym) (sexpr, bool) {
+	i := strings.IndexByte(string(sy), '/')
+	if i <= 0 || i == len(sy)-1 {
+		return nil, false
+	}
+	ns, ok := in.namespaces[sy[:i]]
+	if !ok {
+		return nil, false
+	}
+	v, ok := ns.sc.data[sy[i+1:]]
+	return v, ok
+}
+
+// (in-ns 'name)
+//
+// Makes the namespace name, which is created if it does not exist, the one
+// that top-level forms are evaluated in.
+func builtinInNs(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	name, ok := ss[0].(sym)
+	if !ok || strings.ContainsRune(string(name), '/') {
+		panic("Invalid namespace name")
+	}
+	sc.interp.ns = sc.interp.namespace(name)
+	return name
+}
+
+// (current-ns)
+//
+// Returns the name of the current namespace.
+func builtinCurrentNs(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 0 {
+		panic("Invalid number of arguments")
+	}
+	return sc.interp.ns.name
+}
+
+// (ns-publics 'name)
+//
+// Returns a map of the symbols defined in the namespace name to their values.
+func builtinNsPublics(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	m := newHashMap()
+	for s, v := range sc.interp.namespaceArg(ss[0]).sc.data {
+		m.set(s, v)
+	}
+	return m
+}
+
+// (ns-resolve 'name 'sym)
+//
+// Returns the value that sym refers to in the namespace name, or nil if it
+// is not defined there.
+func builtinNsResolve(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	ns := sc.interp.namespaceArg(ss[0])
+	s, ok := ss[1].(sym)
+	if !ok {
+		panic("Invalid argument")
+	}
+	if v, ok := ns.sc.get(s); ok {
+		return v
+	}
+	return Nil
+}
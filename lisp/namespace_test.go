@@ -0,0 +1,83 @@
+package lisp
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNamespaces(t *testing.T) {
+	in := New()
+	in.Import("strings", map[string]interface{}{"ToUpper": strings.ToUpper})
+	in.Define("answer", 42)
+	err := in.Exec(strings.NewReader(`
+		(define cdr 0)
+		(import "strings")
+		(in-ns 'myapp)
+		(define foo (lambda () answer))
+		(define bar 'b)
+		(in-ns 'user)`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`(current-ns)`, `user`},
+		{`cdr`, `0`},
+		{`(len '(1 2 3))`, `3`},
+		{`(core/cdr '(1 2))`, `(2)`},
+		{`(myapp/foo)`, `42`},
+		{`(strings/ToUpper "a")`, `"A"`},
+		{`(strings.ToUpper "a")`, `"A"`},
+		{`(map-count (ns-publics 'myapp))`, `2`},
+		{`(map-get (ns-publics 'myapp) 'bar)`, `b`},
+		{`(ns-resolve 'myapp 'bar)`, `b`},
+		{`(ns-resolve 'myapp 'answer)`, `42`},
+		{`(ns-resolve 'myapp 'nothing)`, `nil`},
+		{`((ns-resolve 'myapp 'cdr) '(1 2))`, `(2)`},
+		{`(eval 'bar 'myapp)`, `b`},
+		{`(eval '(begin (define baz 1) (current-ns)) 'myapp)`, `user`},
+		{`myapp/baz`, `1`},
+	}
+	for _, test := range tests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+	for _, s := range []string{"foo", "bar", "myapp/cdr", "nowhere/foo"} {
+		if _, err := in.Eval(s); err == nil {
+			t.Errorf("%s is defined in user", s)
+		}
+	}
+}
+
+func TestNamespaceErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"(in-ns 'core)\n(define car 1)",
+			`Cannot define car in the protected namespace core`},
+		{`(eval '(define list 1) 'core)`,
+			`Cannot define list in the protected namespace core`},
+		{`(import "strings" :as core)`,
+			`Cannot define ToUpper in the protected namespace core`},
+		{`(ns-publics 'nowhere)`, `No namespace nowhere`},
+		{`(ns-resolve "user" 'car)`, `Invalid argument`},
+		{`(in-ns 'a/b)`, `Invalid namespace name`},
+	}
+	for _, test := range tests {
+		in := New()
+		in.Import("strings", map[string]interface{}{"ToUpper": strings.ToUpper})
+		err := in.Exec(strings.NewReader(test.src))
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package lisp
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Numbers form a tower. Exact integers are int64 and are promoted to
+// *big.Int when they no longer fit, exact ratios are *big.Rat, and inexact
+// numbers are float64 or, at the top, complex128. Results are always demoted
+// to the narrowest exact type that holds them, so an integer that fits in an
+// int64 is an int64 and a *big.Rat never has a denominator of 1. An operation
+// on a float and an exact number gives a float, and one on a complex number
+// and any other number gives a complex number.
+
+// The levels of the tower, narrowest first.
+const (
+	levelInt = iota
+	levelBig
+	levelRat
+	levelFloat
+	levelComplex
+)
+
+// numLevel returns the level of n in the tower, or -1 if n is not a number.
+func numLevel(n sexpr) int {
+	switch n.(type) {
+	case int64:
+		return levelInt
+	case *big.Int:
+		return levelBig
+	case *big.Rat:
+		return levelRat
+	case float64:
+		return levelFloat
+	case complex128:
+		return levelComplex
+	}
+	return -1
+}
+
+func isNumber(s sexpr) bool {
+	return numLevel(s) >= 0
+}
+
+// isReal reports whether s is a number that can be ordered.
+func isReal(s sexpr) bool {
+	l := numLevel(s)
+	return l >= 0 && l < levelComplex
+}
+
+// parseNumber parses a numeric literal. Integers and ratios such as 1/3 are
+// exact; anything else ParseFloat accepts, such as 1.5 or 2e5, is a float,
+// and a decimal number ending in i, such as 1+2i or 3i, is a complex number.
+func parseNumber(s string) (sexpr, bool) {
+	i, err := strconv.ParseInt(s, 10, 64)
+	if err == nil {
+		return i, true
+	}
+	if err.(*strconv.NumError).Err == strconv.ErrRange {
+		n, _ := new(big.Int).SetString(s, 10)
+		return n, true
+	}
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		n, ok1 := new(big.Int).SetString(num, 10)
+		d, ok2 := new(big.Int).SetString(den, 10)
+		if !ok1 || !ok2 || d.Sign() <= 0 || den[0] == '+' {
+			return nil, false
+		}
+		return normRat(new(big.Rat).SetFrac(n, d)), true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f, true
+	}
+	if isDecimalComplex(s) {
+		if c, err := strconv.ParseComplex(s, 128); err == nil {
+			return c, true
+		}
+	}
+	return nil, false
+}
+
+// isDecimalComplex reports whether s is made of decimal digits, points,
+// exponents and signs followed by an i, like 1+2i or 3i. ParseComplex also
+// accepts hex floats, underscores and names like inf, which would make
+// symbols such as infi numbers.
+func isDecimalComplex(s string) bool {
+	body, ok := strings.CutSuffix(s, "i")
+	return ok && body != "" && strings.Trim(body, "0123456789.eE+-") == ""
+}
+
+func formatFloat(f float64) string {
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".eIN") {
+		// keep floats distinguishable from integers
+		s += ".0"
+	}
+	return s
+}
+
+func formatComplex(c complex128) string {
+	s := strconv.FormatComplex(c, 'g', -1, 128)
+	return s[1 : len(s)-1] // without the parentheses
+}
+
+// normBig demotes n to an int64 if it fits.
+func normBig(n *big.Int) sexpr {
+	if n.IsInt64() {
+		return n.Int64()
+	}
+	return n
+}
+
+// normRat demotes r to an integer if its denominator is 1.
+func normRat(r *big.Rat) sexpr {
+	if r.IsInt() {
+		return normBig(new(big.Int).Set(r.Num()))
+	}
+	return r
+}
+
+func toBig(n sexpr) *big.Int {
+	switch n := n.(type) {
+	case int64:
+		return big.NewInt(n)
+	case *big.Int:
+		return n
+	}
+	panic("Invalid argument")
+}
+
+func toRat(n sexpr) *big.Rat {
+	switch n := n.(type) {
+	case int64:
+		return new(big.Rat).SetInt64(n)
+	case *big.Int:
+		return new(big.Rat).SetInt(n)
+	case *big.Rat:
+		return n
+	}
+	panic("Invalid argument")
+}
+
+func toFloat(n sexpr) float64 {
+	switch n := n.(type) {
+	case int64:
+		return float64(n)
+	case *big.Int:
+		f, _ := new(big.Float).SetInt(n).Float64()
+		return f
+	case *big.Rat:
+		f, _ := n.Float64()
+		return f
+	case float64:
+		return n
+	}
+	panic("Invalid argument")
+}
+
+func toComplex(n sexpr) complex128 {
+	if c, ok := n.(complex128); ok {
+		return c
+	}
+	return complex(toFloat(n), 0)
+}
+
+// toUint64 returns n as a uint64, reporting whether n is an integer in the
+// range of a uint64.
+func toUint64(n sexpr) (uint64, bool) {
+	switch n := n.(type) {
+	case int64:
+		return uint64(n), n >= 0
+	case *big.Int:
+		return n.Uint64(), n.IsUint64()
+	}
+	return 0, false
+}
+
+// levels returns the level at which an operation on a and b is done.
+func levels(a, b sexpr) int {
+	la, lb := numLevel(a), numLevel(b)
+	if la < 0 || lb < 0 {
+		panic("Invalid argument")
+	}
+	if la > lb {
+		return la
+	}
+	return lb
+}
+
+// arith applies the operator op, one of + - * /, to the numbers a and b.
+func arith(op byte, a, b sexpr) sexpr {
+	level := levels(a, b)
+	if op == '/' && level < levelRat {
+		level = levelRat
+	}
+	switch level {
+	case levelInt:
+		if z, ok := intArith(op, a.(int64), b.(int64)); ok {
+			return z
+		}
+		fallthrough
+	case levelBig:
+		x, y := toBig(a), toBig(b)
+		z := new(big.Int)
+		switch op {
+		case '+':
+			z.Add(x, y)
+		case '-':
+			z.Sub(x, y)
+		case '*':
+			z.Mul(x, y)
+		}
+		return normBig(z)
+	case levelRat:
+		x, y := toRat(a), toRat(b)
+		z := new(big.Rat)
+		switch op {
+		case '+':
+			z.Add(x, y)
+		case '-':
+			z.Sub(x, y)
+		case '*':
+			z.Mul(x, y)
+		case '/':
+			if y.Sign() == 0 {
+				panic("Division by zero")
+			}
+			z.Quo(x, y)
+		}
+		return normRat(z)
+	case levelFloat:
+		x, y := toFloat(a), toFloat(b)
+		switch op {
+		case '+':
+			return x + y
+		case '-':
+			return x - y
+		case '*':
+			return x * y
+		}
+		return x / y
+	}
+	x, y := toComplex(a), toComplex(b)
+	switch op {
+	case '+':
+		return x + y
+	case '-':
+		return x - y
+	case '*':
+		return x * y
+	}
+	return x / y
+}
+
+// intArith applies op to a and b, reporting false if the result overflows.
+func intArith(op byte, a, b int64) (int64, bool) {
+	switch op {
+	case '+':
+		c := a + b
+		return c, (a^c)&(b^c) >= 0
+	case '-':
+		c := a - b
+		return c, (a^b)&(a^c) >= 0
+	case '*':
+		if a == 0 || b == 0 {
+			return 0, true
+		}
+		c := a * b
+		ok := c/b == a && !(a == -1 && b == math.MinInt64) &&
+			!(b == -1 && a == math.MinInt64)
+		return c, ok
+	}
+	return 0, false
+}
+
+// unordered is what numCompare returns when a float is NaN or complex
+// numbers differ.
+const unordered = 2
+
+// numCompare compares the numbers a and b, returning -1, 0 or 1 as a is less
+// than, equal to or greater than b, or unordered. Complex numbers are only
+// ever equal or unordered.
+func numCompare(a, b sexpr) int {
+	switch levels(a, b) {
+	case levelInt:
+		x, y := a.(int64), b.(int64)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	case levelBig:
+		return toBig(a).Cmp(toBig(b))
+	case levelRat:
+		return toRat(a).Cmp(toRat(b))
+	case levelComplex:
+		if toComplex(a) == toComplex(b) {
+			return 0
+		}
+		return unordered
+	}
+	x, y := toFloat(a), toFloat(b)
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	case x == y:
+		return 0
+	}
+	return unordered
+}
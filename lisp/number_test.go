@@ -0,0 +1,79 @@
+package lisp
+
+import (
+	"bufio"
+	"math/cmplx"
+	"strings"
+	"testing"
+)
+
+var numberTests = []struct {
+	src  string
+	want string
+}{
+	{"(+ 1 2)", "3"},
+	{"(+ 9223372036854775807 1)", "9223372036854775808"},
+	{"(- -9223372036854775808 1)", "-9223372036854775809"},
+	{"(* -1 -9223372036854775808)", "9223372036854775808"},
+	{"(- 9223372036854775808 1)", "9223372036854775807"},
+	{"(/ 6 4)", "3/2"},
+	{"(/ 6 3)", "2"},
+	{"(+ 1/2 1/2)", "1"},
+	{"(* 2 1.5)", "3.0"},
+	{"(+ 1/4 0.25)", "0.5"},
+	{"(% 10 4)", "2"},
+	{"(% 18446744073709551617 2)", "1"},
+	{"(/ 1 0.0)", "+Inf"},
+	{"2e5", "200000.0"},
+	{"1+2i", "1+2i"},
+	{"(+ 1+2i 1)", "2+2i"},
+	{"(* 2i 2i)", "-4+0i"},
+	{"(/ 1+1i 1/2)", "2+2i"},
+	{"(= 1+0i 1)", "true"},
+	{"(cmplx.Sqrt -4)", "0+2i"},
+	{"(cmplx.Abs 3+4i)", "5.0"},
+	{"(complex64 1.5-1i)", "1.5-1i"},
+	{"1e2-5e-1i", "100-0.5i"},
+	{"3i", "0+3i"},
+}
+
+// Names that ParseComplex would take for complex numbers, and that must read
+// as symbols.
+func TestComplexLookalikes(t *testing.T) {
+	for _, src := range []string{
+		"infi", "+infi", "nani", "Infinityi", "1+infi", "0x1p2i", "1_0i", "i",
+	} {
+		v, err := parse(bufio.NewReader(strings.NewReader(src)))
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if s, ok := v.(sym); !ok || string(s) != src {
+			t.Errorf("%s read as %s (%T), want a symbol", src, asString(v), v)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	in := New()
+	in.Define("cmplx.Sqrt", cmplx.Sqrt)
+	in.Define("cmplx.Abs", cmplx.Abs)
+	in.Define("complex64", func(c complex64) complex64 { return c })
+	for _, test := range numberTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestNumberErrors(t *testing.T) {
+	in := New()
+	for _, src := range []string{
+		"(/ 1 0)", "(% 1 0)", "(% 1/2 1)", "(+ 1 'a)", "(< 1i 2i)",
+	} {
+		if _, err := in.Eval(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
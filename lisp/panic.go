@@ -1,6 +1,11 @@
 package lisp
 
 // (recover '(id ...) expr handler)
+//
+// Calls expr with no arguments, and if it panics with one of the ids, or
+// with anything if the ids include _, returns the result of calling handler
+// with the panic value instead. A handler that takes a second argument is
+// also given the error being handled, which (backtrace) takes.
 func builtinRecover(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 3 {
 		panic("Invalid number of arguments")
@@ -17,9 +22,14 @@ func builtinRecover(sc *scope, ss []sexpr) sexpr {
 			if r == nil {
 				return
 			}
+			v := panicValue(r)
 			for _, id := range ids {
-				if r == id || id == sym('_') {
-					ret = apply(sc, handler, []sexpr{r})
+				if v == id || id == sym('_') {
+					args := []sexpr{v}
+					if takesError(handler) {
+						args = append(args, asError(r))
+					}
+					ret = apply(sc, handler, args)
 					return
 				}
 			}
@@ -30,6 +40,13 @@ func builtinRecover(sc *scope, ss []sexpr) sexpr {
 	return ret
 }
 
+// takesError reports whether the recover handler h takes a second argument,
+// for the error being handled.
+func takesError(h sexpr) bool {
+	l, ok := h.(*lambda)
+	return ok && (len(l.proc.names) >= 2 || l.proc.rest)
+}
+
 // (panic 'id)
 func builtinPanic(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 1 {
@@ -39,3 +56,27 @@ func builtinPanic(sc *scope, ss []sexpr) sexpr {
 	id := ss[0]
 	panic(id)
 }
+
+// (backtrace err)
+//
+// Returns the backtrace of err, an error given to a recover handler, as a
+// list of strings, innermost frame first.
+func builtinBacktrace(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	e, ok := ss[0].(*Error)
+	if !ok {
+		panic("Expected an error")
+	}
+	var frames []sexpr
+	for _, f := range e.Backtrace {
+		if f.Form == nil {
+			// the outermost frame, when the panic was recovered before
+			// reaching any code outside a function
+			continue
+		}
+		frames = append(frames, f.String())
+	}
+	return unflatten(frames)
+}
@@ -3,7 +3,6 @@ package lisp
 import (
 	"bytes"
 	"io"
-	"strconv"
 	"strings"
 )
 
@@ -20,10 +19,12 @@ func readToken(r io.RuneScanner) (token, error) {
 	)
 
 	// Single-rune tokens
-	const TOKS = "()"
+	const TOKS = "(){}[]"
 	const WS = " \t\r\n"
 	const SPLIT = TOKS + WS + ";"
-	const PROTECT = '\''
+	// Quote characters, which are tokens of their own that apply to the
+	// s-expression following them
+	const PROTECT = "'`,"
 
 	state := READY
 	var tmp bytes.Buffer
@@ -37,6 +38,7 @@ func readToken(r io.RuneScanner) (token, error) {
 		case READY:
 			// c either begins or is a token
 			if strings.ContainsRune(TOKS, ch) {
+				markToken(r)
 				return token(ch), nil
 			} else if strings.ContainsRune(WS, ch) {
 				// whitespace; ignore it
@@ -44,11 +46,23 @@ func readToken(r io.RuneScanner) (token, error) {
 				// read to EOL
 				state = COMMENT
 			} else if ch == '"' {
+				markToken(r)
 				tmp.WriteRune(ch)
 				state = STRLIT
-			} else if ch == PROTECT {
+			} else if strings.ContainsRune(PROTECT, ch) {
+				markToken(r)
+				if ch == ',' {
+					// ,@ is a token of its own
+					next, _, err := r.ReadRune()
+					if err == nil && next == '@' {
+						return _SPLICE, nil
+					} else if err == nil {
+						r.UnreadRune()
+					}
+				}
 				return token(ch), nil
 			} else {
+				markToken(r)
 				tmp.WriteRune(ch)
 				state = READING
 			}
@@ -122,9 +136,24 @@ var Nil = interface{}(nil)
 const (
 	_LPAREN  = "("
 	_RPAREN  = ")"
+	_LBRACE  = "{"
+	_RBRACE  = "}"
+	_LBRACK  = "["
+	_RBRACK  = "]"
 	_PROTECT = "'"
+	_QUASI   = "`"
+	_UNQUOTE = ","
+	_SPLICE  = ",@"
 )
 
+// The forms that the quote tokens read as: 'x is read as (quote x), and so on.
+var quoteForms = map[token]sym{
+	_PROTECT: "quote",
+	_QUASI:   "quasiquote",
+	_UNQUOTE: "unquote",
+	_SPLICE:  "unquote-splicing",
+}
+
 func parse(r io.RuneScanner) (sexpr, error) {
 	tok, err := readToken(r)
 	if err == nil {
@@ -136,20 +165,32 @@ func parse(r io.RuneScanner) (sexpr, error) {
 func parseNext(tok token, r io.RuneScanner) sexpr {
 	switch tok {
 	case _LPAREN:
-		return parseCons(r)
+		return parseCons(r, tokenPos(r))
 	case _RPAREN:
 		panic("Unmatched ')'")
-	case _PROTECT:
+	case _LBRACE:
+		return parseMap(r)
+	case _RBRACE:
+		panic("Unmatched '}'")
+	case _LBRACK:
+		return &vector{parseItems(r, _RBRACK)}
+	case _RBRACK:
+		panic("Unmatched ']'")
+	case _PROTECT, _QUASI, _UNQUOTE, _SPLICE:
+		pos := tokenPos(r)
 		s, e := parse(r)
 		if e != nil {
 			panic(e)
 		}
-		return cons{sym("quote"), cons{s, nil}}
+		quoted := cons{car: s, cdr: nil, pos: pos}
+		return cons{car: quoteForms[tok], cdr: quoted, pos: pos}
 	}
 	return parseAtom(tok)
 }
 
-func parseCons(r io.RuneScanner) sexpr {
+// parseCons parses the rest of a list. pos is the position of the first cons
+// of the list.
+func parseCons(r io.RuneScanner, pos *Pos) sexpr {
 	// note that we assume the LPAREN has already been read
 	tok, err := readToken(r)
 	if err != nil {
@@ -174,9 +215,37 @@ func parseCons(r io.RuneScanner) sexpr {
 		}
 		return ret
 	}
+	if pos == nil {
+		pos = tokenPos(r)
+	}
 	car := parseNext(tok, r)
-	cdr := parseCons(r)
-	return cons{car, cdr}
+	cdr := parseCons(r, nil)
+	return cons{car: car, cdr: cdr, pos: pos}
+}
+
+// parseItems parses items up to the token end, which is consumed.
+func parseItems(r io.RuneScanner, end token) []sexpr {
+	items := []sexpr{}
+	for {
+		tok, err := readToken(r)
+		if err != nil {
+			panic(err)
+		}
+		if tok == end {
+			return items
+		}
+		items = append(items, parseNext(tok, r))
+	}
+}
+
+// parseMap parses the rest of a map literal.
+func parseMap(r io.RuneScanner) sexpr {
+	// the LBRACE has already been read
+	items := parseItems(r, _RBRACE)
+	if len(items)%2 != 0 {
+		panic("Map literal with an odd number of elements")
+	}
+	return mapLiteral(items)
 }
 
 func parseAtom(tok token) (e sexpr) {
@@ -187,9 +256,13 @@ func parseAtom(tok token) (e sexpr) {
 		e = string(tok[1 : len(tok)-1])
 	}
 
+	// try as keyword
+	if tok[0] == ':' && len(tok) > 1 {
+		e = keyword(tok[1:])
+	}
+
 	// try as number
-	n, err := strconv.ParseFloat(string(tok), 64)
-	if err == nil {
+	if n, ok := parseNumber(string(tok)); ok {
 		e = n
 	}
 	return
@@ -1,6 +1,8 @@
 package lisp
 
 import (
+	"bufio"
+	"math/big"
 	"strings"
 	"testing"
 )
@@ -18,6 +20,10 @@ var readTokenTests = []readTokenTest{
 	{" \t5;6", "5"},
 	{"(", "("},
 	{")(", ")"},
+	{"`(a)", "`"},
+	{",a", ","},
+	{",@a", ",@"},
+	{", @a", ","},
 }
 
 func TestReadToken(t *testing.T) {
@@ -39,19 +45,33 @@ type parseTest struct{
 }
 
 var parseTests = []parseTest{
-	{"1\n", 1.0},
-	{"1", 1.0},
+	{"1\n", int64(1)},
+	{"1", int64(1)},
+	{"-7", int64(-7)},
 	{"5.5\n", 5.5},
 	{"5e-9\n", 5e-9},
+	{"2.", 2.0},
+	{"1/3", big.NewRat(1, 3)},
+	{"4/2", int64(2)},
+	{"1/0", sym("1/0")},
+	{"99999999999999999999", bigInt("99999999999999999999")},
 	{"x\n", sym("x")},
 	{"5%x\n", sym("5%x")},
 	{"\"a\"", "a"},
 
 	{"()", Nil},
-	{"(())", cons{nil, nil}},
-	{"(1)", cons{1.0, nil}},
+	{"(())", cons{car: nil, cdr: nil}},
+	{"(1)", cons{car: int64(1), cdr: nil}},
 	{"(1 (2 3) ())",
-		cons{1.0, cons{cons{2.0, cons{3.0, nil}}, cons{nil, nil}}}},
+		cons{car: int64(1), cdr: cons{
+			car: cons{car: int64(2), cdr: cons{car: int64(3), cdr: nil}},
+			cdr: cons{car: nil, cdr: nil}}}},
+	{"`(a ,b ,@c)", cons{car: sym("quasiquote"), cdr: cons{
+		car: cons{car: sym("a"), cdr: cons{
+			car: cons{car: sym("unquote"), cdr: cons{car: sym("b")}},
+			cdr: cons{
+				car: cons{car: sym("unquote-splicing"),
+					cdr: cons{car: sym("c")}}}}}}}},
 }
 
 func eqS(a sexpr, b sexpr) bool {
@@ -63,9 +83,17 @@ func eqS(a sexpr, b sexpr) bool {
 		}
 		return eqS(ac.car, bc.car) && eqS(ac.cdr, bc.cdr)
 	}
+	if isNumber(a) {
+		return numLevel(a) == numLevel(b) && numCompare(a, b) == 0
+	}
 	return a == b
 }
 
+func bigInt(s string) *big.Int {
+	n, _ := new(big.Int).SetString(s, 10)
+	return n
+}
+
 func TestParse(t *testing.T) {
 	for _, test := range parseTests {
 		r := strings.NewReader(test.str)
@@ -78,3 +106,30 @@ func TestParse(t *testing.T) {
 		}
 	}
 }
+
+func TestParsePositions(t *testing.T) {
+	r := newPosReader("f.lisp", bufio.NewReader(strings.NewReader(
+		"\n  (a\n (b c) 'd)")))
+	res, err := parse(r)
+	if err != nil {
+		t.Fatalf("ERROR: %s", err.Error())
+	}
+	outer := res.(cons)
+	inner := outer.cdr.(cons).car.(cons)
+	quoted := outer.cdr.(cons).cdr.(cons).car.(cons)
+	tests := []struct {
+		c   cons
+		pos Pos
+	}{
+		{outer, Pos{"f.lisp", 2, 3}},
+		{outer.cdr.(cons), Pos{"f.lisp", 3, 2}},
+		{inner, Pos{"f.lisp", 3, 2}},
+		{inner.cdr.(cons), Pos{"f.lisp", 3, 5}},
+		{quoted, Pos{"f.lisp", 3, 8}},
+	}
+	for _, test := range tests {
+		if test.c.pos == nil || *test.c.pos != test.pos {
+			t.Errorf("%s at %v, want %s", test.c, test.c.pos, test.pos)
+		}
+	}
+}
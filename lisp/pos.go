@@ -0,0 +1,81 @@
+package lisp
+
+import (
+	"fmt"
+	"io"
+)
+
+// A Pos is a location in Lisp source code.
+type Pos struct {
+	File string
+	Line int
+	Col  int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// posReader is an io.RuneScanner that keeps track of the position of the
+// runes read through it, so the parser can record where each form starts.
+type posReader struct {
+	r    io.RuneScanner
+	next Pos // position of the next rune
+	last Pos // position of the last rune read
+	tok  Pos // position of the first rune of the last token
+}
+
+func newPosReader(file string, r io.RuneScanner) *posReader {
+	return &posReader{r: r, next: Pos{file, 1, 1}}
+}
+
+func (pr *posReader) ReadRune() (ch rune, size int, err error) {
+	ch, size, err = pr.r.ReadRune()
+	if err != nil {
+		return
+	}
+	pr.last = pr.next
+	if ch == '\n' {
+		pr.next.Line++
+		pr.next.Col = 1
+	} else {
+		pr.next.Col++
+	}
+	return
+}
+
+func (pr *posReader) UnreadRune() error {
+	err := pr.r.UnreadRune()
+	if err == nil {
+		pr.next = pr.last
+	}
+	return err
+}
+
+// markToken records that the rune last read from r starts a token.
+func markToken(r io.RuneScanner) {
+	if pr, ok := r.(*posReader); ok {
+		pr.tok = pr.last
+	}
+}
+
+// tokenPos returns the position of the last token read from r, or nil if r
+// does not track positions.
+func tokenPos(r io.RuneScanner) *Pos {
+	if pr, ok := r.(*posReader); ok {
+		p := pr.tok
+		return &p
+	}
+	return nil
+}
+
+// posOf returns the source position of e, or nil if it is unknown.
+func posOf(e sexpr) *Pos {
+	if c, ok := e.(cons); ok {
+		return c.pos
+	}
+	return nil
+}
@@ -5,10 +5,20 @@ import "fmt"
 type primitive_t struct {
 	name string
 	f func(*scope, []sexpr) sexpr
+	tail tailForm
 }
 
+// A tailForm is the implementation of a primitive whose result is that of a
+// form in tail position. Rather than evaluating the form itself, it returns the
+// form and the scope it is to be evaluated in, leaving the evaluation to eval.
+type tailForm func(*scope, []sexpr) (*scope, sexpr)
+
 func primitive(name string, f func(*scope, []sexpr) sexpr) primitive_t {
-	return primitive_t{name, f}
+	return primitive_t{name: name, f: f}
+}
+
+func tailPrimitive(name string, f tailForm) primitive_t {
+	return primitive_t{name: name, tail: f}
 }
 
 // (go expr)
@@ -22,18 +32,18 @@ func primitiveGo(sc *scope, ss []sexpr) sexpr {
 
 
 // (if cond expr1 expr2)
-func primitiveIf(sc *scope, ss []sexpr) sexpr {
+func primitiveIf(sc *scope, ss []sexpr) (*scope, sexpr) {
 	if len(ss) < 2 || len(ss) > 3 {
 		panic("Invalid number of arguments to primitive if")
 	}
 	cond := ss[0]
-	cv := eval(sc, cond)
+	cv := primary(eval(sc, cond))
 	if IsTrue(cv) {
-		return eval(sc, ss[1])
+		return sc, ss[1]
 	} else if len(ss) == 3 {
-		return eval(sc, ss[2])
+		return sc, ss[2]
 	}
-	return Nil
+	return sc, Nil
 }
 
 // (for cond expr)
@@ -44,70 +54,99 @@ func primitiveFor(sc *scope, ss []sexpr) sexpr {
 	cond := ss[0]
 	expr := ss[1]
 	val := Nil
-	cv := eval(sc, cond)
+	cv := primary(eval(sc, cond))
 	for cv != nil {
 		val = eval(sc, expr)
-		cv = eval(sc, cond)
+		cv = primary(eval(sc, cond))
 	}
 	return val
 }
 
+// A lambda is a function defined in Lisp.
+type lambda struct {
+	name   sym   // the name it was defined with; empty if anonymous
+	params sexpr // parameter specification
+	body   sexpr
+	env    *scope // scope the lambda was created in
+	proc   *proc  // compiled body
+}
+
 // (lambda (arg1 ...) expr)
 func primitiveLambda(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 2 {
 		panic("Invalid number of arguments")
 	}
-	expr := ss[1]
-	evalScopeParent := newScope(sc)
-	var args_ = ss[0]
 	// TODO type check the args list
-	return function(func(callScope *scope, ss []sexpr) sexpr {
-		args := args_
-		evalScope := newScope(evalScopeParent)
-		// Match args with ss
-		aC, ok := args.(cons)
-		for args != nil {
-			if len(ss) == 0 {
-				panic("Invalid number of arguments")
-			}
-			if !ok {
-				// turn ss back into a cons
-				val := unflatten(ss)
-				s, k := args.(sym)
-				if !k {
-					panic("Invalid parameter specification")
-				}
-				evalScope.define(s, val)
-				goto done
-			}
-			arg := aC.car
-			val := ss[0]
-			s, k := arg.(sym)
+	return &lambda{params: ss[0], body: ss[1], env: sc,
+		proc: newProc(ss[0], nil)}
+}
+
+// call applies l to the already evaluated arguments ss.
+func (l *lambda) call(ss []sexpr) sexpr {
+	if c := l.compiled(); c != nil {
+		return l.run(c, ss)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			panic(wrapCall(r, l))
+		}
+	}()
+	return eval(l.bind(ss), l.body)
+}
+
+// bind returns a new scope in which the parameters of l are bound to the
+// arguments ss.
+func (l *lambda) bind(ss []sexpr) *scope {
+	if p := l.proc; p.slots {
+		return newFrame(l.env, p.names, bindSlots(len(p.names), p.rest, ss))
+	}
+	// Binding the parameters is going to fail, but give the same errors
+	// as for a valid specification up to the point of failure.
+	args := l.params
+	evalScope := newScope(l.env)
+	// Match args with ss
+	aC, ok := args.(cons)
+	for args != nil {
+		if len(ss) == 0 {
+			panic("Invalid number of arguments")
+		}
+		if !ok {
+			// turn ss back into a cons
+			val := unflatten(ss)
+			s, k := args.(sym)
 			if !k {
 				panic("Invalid parameter specification")
 			}
 			evalScope.define(s, val)
-
-			ss = ss[1:]
-			args = aC.cdr
-			aC, ok = args.(cons)
+			return evalScope
 		}
-		if len(ss) > 0 {
-			panic("Invalid number of arguments")
+		arg := aC.car
+		val := ss[0]
+		s, k := arg.(sym)
+		if !k {
+			panic("Invalid parameter specification")
 		}
-	done:
-		return eval(evalScope, expr)
-	})
+		evalScope.define(s, val)
+
+		ss = ss[1:]
+		args = aC.cdr
+		aC, ok = args.(cons)
+	}
+	if len(ss) > 0 {
+		panic("Invalid number of arguments")
+	}
+	return evalScope
 }
 
 // (let ((sym1 val1) ...) expr1 ...)
-func primitiveLet(sc *scope, ss []sexpr) sexpr {
+func primitiveLet(sc *scope, ss []sexpr) (*scope, sexpr) {
 	if len(ss) < 1 {
 		panic("Invalid number of arguments")
 	}
-	evalScope := newScope(sc)
 	bindings := flatten(ss[0])
-	for _, b := range bindings {
+	names := make([]sym, len(bindings))
+	vals := make([]sexpr, len(bindings))
+	for i, b := range bindings {
 		bs := flatten(b)
 		if len(bs) != 2 {
 			panic("Invalid binding")
@@ -116,19 +155,45 @@ func primitiveLet(sc *scope, ss []sexpr) sexpr {
 		if !ok {
 			panic("Invalid binding")
 		}
-		val := eval(sc, bs[1])
-		evalScope.define(s, val)
+		names[i] = s
+		vals[i] = primary(eval(sc, bs[1]))
 	}
 
-	prog := ss[1:]
-	last := Nil
-	for _, l := range prog {
-		last = eval(evalScope, l)
+	return primitiveBegin(letFrame(sc, names, vals), ss[1:])
+}
+
+// letFrame creates the scope for the body of a let binding names to vals.
+func letFrame(parent *scope, names []sym, vals []sexpr) *scope {
+	if distinct(names) {
+		return newFrame(parent, names, vals)
 	}
-	return last
+	// The last of several bindings of a name wins.
+	sc := newScope(parent)
+	for i, name := range names {
+		sc.define(name, vals[i])
+	}
+	return sc
 }
 
-// (defmacro f (arg1 arg2 ...) body)
+// distinct reports whether no symbol appears twice in names.
+func distinct(names []sym) bool {
+	for i, n := range names {
+		for _, m := range names[:i] {
+			if n == m {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// (defmacro name lambda-list body)
+//
+// Defines a macro. When it is applied, body is evaluated with the symbols of
+// the lambda list bound to the unevaluated argument forms, and the form it
+// returns is evaluated in place of the application. The lambda list may have
+// &optional, &rest (or &body, or a dotted tail) and &key parameters, and
+// nested lambda lists to take the argument forms apart; see lambdaList.
 func primitiveDefmacro(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 3 {
 		msg := fmt.Sprintf(
@@ -142,54 +207,10 @@ func primitiveDefmacro(sc *scope, ss []sexpr) sexpr {
 			"defmacro, got", ss[0])
 		panic(msg)
 	}
-	argNames := unpackSymList(ss[1])
-	bodyScope := newScope(sc)
-	for _, argName := range(argNames) {
-		bodyScope.define(argName, argName)
-	}
-	body := eval(bodyScope, ss[2])
-	m := macro{idSym, argNames, body}
-	sc.defineHigh(idSym, m)
+	sc.defineHigh(idSym, lambdaMacro(idSym, ss[1], ss[2], sc))
 	return Nil
 }
 
-// (macroexpand-1 '(macroName arg1 arg2 ...))
-// Runs the specified macro on the arguments, returning the resulting AST
-// but not evaluating it.
-func primitiveMacroexpand1(sc *scope, ss []sexpr) sexpr {
-	if len(ss) != 1 {
-		msg := fmt.Sprint("Expected one argument to macroexpand-1,",
-			"got", len(ss))
-		panic(msg)
-	}
-	ss2 := flatten(eval(sc, ss[0]))
-	first := eval(sc, ss2[0])
-	switch m := first.(type) {
-	case macro:
-		return m.expand(ss2[1:len(ss2)])
-	}
-	msg := fmt.Sprintf("In macroexpand-1, expected a macro, got %s",
-		asString(ss2[0]))
-	panic(msg)
-}
-
-// unpackSymList converts an expression containing a list of symbols to a slice
-// of syms.
-func unpackSymList(e sexpr) []sym {
-	symExprs := flatten(e)
-	slice := make([]sym, len(symExprs))
-	for i, e2 := range(symExprs) {
-		s, ok := e2.(sym)
-		if !ok {
-			msg := fmt.Sprintf("Expected a symbol, got %s",
-				asString(e2));
-			panic(msg)
-		}
-		slice[i] = s
-	}
-	return slice
-}
-
 // (define keyword expression)
 func primitiveDefine(sc *scope, ss []sexpr) sexpr {
 	if len(ss) != 2 {
@@ -199,7 +220,11 @@ func primitiveDefine(sc *scope, ss []sexpr) sexpr {
 	if !ok {
 		panic("Invalid argument")
 	}
-	val := eval(sc, ss[1])
+	val := primary(eval(sc, ss[1]))
+	if l, ok := val.(*lambda); ok && l.name == "" {
+		// name the function for backtraces
+		l.name = idSym
+	}
 	sc.defineHigh(idSym, val)
 	return Nil
 }
@@ -217,10 +242,12 @@ func primitiveQuote(sc *scope, ss []sexpr) sexpr {
 // This could be implemented (in large part, at least) as an ordinary function
 // taking variable arguments; however, in the interest of clarity of behaviour,
 // it is not.
-func primitiveBegin(sc *scope, ss []sexpr) sexpr {
-	last := Nil
-	for _, l := range ss {
-		last = eval(sc, l)
+func primitiveBegin(sc *scope, ss []sexpr) (*scope, sexpr) {
+	if len(ss) == 0 {
+		return sc, Nil
+	}
+	for _, l := range ss[:len(ss)-1] {
+		eval(sc, l)
 	}
-	return last
+	return sc, ss[len(ss)-1]
 }
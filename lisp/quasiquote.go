@@ -0,0 +1,127 @@
+package lisp
+
+// (quasiquote template)
+//
+// Returns template unevaluated, like quote, except for the parts of it that
+// are unquoted: (unquote expr), written ,expr, is replaced by the value of
+// expr, and (unquote-splicing expr), written ,@expr, by the items of the list
+// or vector expr evaluates to. Quasiquotes may be nested, written `template,
+// in which case the unquotes are matched to the quasiquote they belong to by
+// level, and only those of the outermost one are evaluated.
+func primitiveQuasiquote(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return quasi(sc, ss[0], 1)
+}
+
+// (unquote expr)
+func primitiveUnquote(sc *scope, ss []sexpr) sexpr {
+	panic("unquote outside of quasiquote")
+}
+
+// (unquote-splicing expr)
+func primitiveUnquoteSplicing(sc *scope, ss []sexpr) sexpr {
+	panic("unquote-splicing outside of quasiquote")
+}
+
+// quoteForm returns the argument of x if x is a form (name arg), such as
+// (unquote arg).
+func quoteForm(x sexpr, name sym) (sexpr, bool) {
+	c, ok := x.(cons)
+	if !ok || c.car != name {
+		return nil, false
+	}
+	rest, ok := c.cdr.(cons)
+	if !ok || rest.cdr != nil {
+		return nil, false
+	}
+	return rest.car, true
+}
+
+// quasi expands the template x of a quasiquote that is nested depth levels
+// deep.
+func quasi(sc *scope, x sexpr, depth int) sexpr {
+	if arg, ok := quoteForm(x, "unquote"); ok {
+		if depth == 1 {
+			return primary(eval(sc, arg))
+		}
+		return quoteWith(x, "unquote", quasi(sc, arg, depth-1))
+	}
+	if arg, ok := quoteForm(x, "quasiquote"); ok {
+		return quoteWith(x, "quasiquote", quasi(sc, arg, depth+1))
+	}
+	if _, ok := quoteForm(x, "unquote-splicing"); ok && depth == 1 {
+		panic("unquote-splicing outside of a list")
+	}
+	switch x := x.(type) {
+	case cons:
+		var items []sexpr
+		var tail sexpr = x
+		for {
+			c, ok := tail.(cons)
+			if !ok {
+				break
+			}
+			if _, ok := quoteForm(c, "unquote"); ok {
+				// a dotted tail, as in (a . ,b)
+				break
+			}
+			items = append(items, quasiItem(sc, c.car, depth)...)
+			tail = c.cdr
+		}
+		if tail != nil {
+			tail = quasi(sc, tail, depth)
+		}
+		for i := len(items) - 1; i >= 0; i-- {
+			tail = cons{car: items[i], cdr: tail}
+		}
+		if c, ok := tail.(cons); ok {
+			c.pos = x.pos
+			return c
+		}
+		return tail
+	case *vector:
+		var items []sexpr
+		for _, item := range x.items {
+			items = append(items, quasiItem(sc, item, depth)...)
+		}
+		return &vector{items}
+	case *hashMap:
+		var items []sexpr
+		for _, item := range x.literal() {
+			items = append(items, quasiItem(sc, item, depth)...)
+		}
+		if len(items)%2 != 0 {
+			panic("Map literal with an odd number of elements")
+		}
+		return mapLiteral(items)
+	}
+	return x
+}
+
+// quasiItem expands the item x of a list, vector or map in a quasiquote
+// template, returning the items it is replaced by.
+func quasiItem(sc *scope, x sexpr, depth int) []sexpr {
+	arg, ok := quoteForm(x, "unquote-splicing")
+	if !ok {
+		return []sexpr{quasi(sc, x, depth)}
+	}
+	if depth > 1 {
+		return []sexpr{quoteWith(x, "unquote-splicing", quasi(sc, arg, depth-1))}
+	}
+	v := primary(eval(sc, arg))
+	if v, ok := v.(*vector); ok {
+		return v.items
+	}
+	items, ok := listItems(v)
+	if !ok {
+		panic("unquote-splicing of a value that is not a list")
+	}
+	return items
+}
+
+// quoteWith returns the form (name arg), positioned where the form x is.
+func quoteWith(x sexpr, name sym, arg sexpr) sexpr {
+	return cons{car: name, cdr: cons{car: arg, cdr: nil}, pos: x.(cons).pos}
+}
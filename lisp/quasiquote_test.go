@@ -0,0 +1,65 @@
+package lisp
+
+import (
+	"fmt"
+	"testing"
+)
+
+var quasiquoteTests = []struct {
+	src  string
+	want string
+}{
+	{"`a", "a"},
+	{"`(a b)", "(a b)"},
+	{"`(a ,(+ 1 2))", "(a 3)"},
+	{"`(a ,@(list 1 2) b)", "(a 1 2 b)"},
+	{"`(,@nil)", "nil"},
+	{"`(a ,@[1 2])", "(a 1 2)"},
+	{"`[a ,(+ 1 1) ,@(list 3 4)]", "[a 2 3 4]"},
+	{"`(a . ,(+ 1 1))", "(a . 2)"},
+	{"`(a ,(values 1 2))", "(a 1)"},
+	{"`(a ,@(values (list 1 2) 3))", "(a 1 2)"},
+	{"(let ((x 9)) `{:a ,x})", "{:a 9}"},
+	{"`{:b 2 ,@(list :a 1) ,@nil}", "{:a 1 :b 2}"},
+	{"`(1 `(2 ,(3 ,(+ 1 3))))",
+		"(1 (quasiquote (2 (unquote (3 4)))))"},
+	{"`(1 `(2 ,@(3 ,@(list 4 5))))",
+		"(1 (quasiquote (2 (unquote-splicing (3 4 5)))))"},
+	{"(let ((x 5)) `(1 `(2 ,,x ,x)))",
+		"(1 (quasiquote (2 (unquote 5) (unquote x))))"},
+	{"((lambda (x) `(x ,x)) 7)", "(x 7)"},
+	{"(let ((xs '(2 3))) `(1 ,@xs 4))", "(1 2 3 4)"},
+	{"(begin (defmacro swap (a b) `(list ,b ,a)) (swap 1 2))", "(2 1)"},
+}
+
+func TestQuasiquote(t *testing.T) {
+	for _, test := range quasiquoteTests {
+		in := New()
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestQuasiquoteErrors(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{",a", "unquote outside of quasiquote"},
+		{",@a", "unquote-splicing outside of quasiquote"},
+		{"`,@(list 1)", "unquote-splicing outside of a list"},
+		{"`(a ,@1)", "unquote-splicing of a value that is not a list"},
+		{"`{:a ,@(list 1 2)}", "Map literal with an odd number of elements"},
+	}
+	for _, test := range tests {
+		_, err := New().Eval(test.src)
+		if err == nil {
+			t.Errorf("%s: expected an error", test.src)
+			continue
+		}
+		if msg := fmt.Sprint(err.(*Error).Value); msg != test.want {
+			t.Errorf("%s: got %q, want %q", test.src, msg, test.want)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package lisp
+
+import (
+	"sort"
+	"sync"
+)
+
+// A package registered with RegisterPackage. Its identifiers are loaded the
+// first time it is imported.
+type registered struct {
+	load func() map[string]interface{}
+	once sync.Once
+	pkg  map[string]interface{}
+}
+
+var (
+	registryMu sync.Mutex
+	registry   = make(map[string]*registered)
+)
+
+// RegisterPackage makes a Go package importable under the import path name
+// in every interpreter. load returns the identifiers of the package in the
+// form taken by Interpreter.Import, and is only called once the package is
+// first imported. Bindings generated by scanpkgs call RegisterPackage from
+// init.
+func RegisterPackage(name string, load func() map[string]interface{}) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[name] = &registered{load: load}
+}
+
+// RegisteredPackages returns the import paths of the registered packages in
+// order.
+func RegisteredPackages() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupPackage returns the package imported as name in in: either one given
+// to Import or one that has been registered.
+func (in *Interpreter) lookupPackage(name string) (map[string]interface{}, bool) {
+	if pkg, ok := in.imports[name]; ok {
+		return pkg, true
+	}
+	registryMu.Lock()
+	r, ok := registry[name]
+	registryMu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	r.once.Do(func() { r.pkg = r.load() })
+	return r.pkg, true
+}
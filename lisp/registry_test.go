@@ -0,0 +1,54 @@
+package lisp
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegisterPackage(t *testing.T) {
+	loads := 0
+	RegisterPackage("example/lazy", func() map[string]interface{} {
+		loads++
+		return map[string]interface{}{
+			"Upper": strings.ToUpper,
+			"Size":  int64(3),
+		}
+	})
+	found := false
+	for _, name := range RegisteredPackages() {
+		found = found || name == "example/lazy"
+	}
+	if !found {
+		t.Errorf("example/lazy is not among %v", RegisteredPackages())
+	}
+
+	for i := 0; i < 2; i++ {
+		in := New()
+		if loads != i {
+			t.Fatalf("loaded %d times before import %d", loads, i+1)
+		}
+		mustEval(t, in, `(import "example/lazy")`)
+		if v := mustEval(t, in, `(lazy.Upper "go")`); v != "GO" {
+			t.Errorf(`(lazy.Upper "go") = %v, want "GO"`, v)
+		}
+		if v := mustEval(t, in, `lazy.Size`); v != int64(3) {
+			t.Errorf("lazy.Size = %v, want 3", v)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("loaded %d times, want 1", loads)
+	}
+}
+
+func TestImportOverridesRegistry(t *testing.T) {
+	RegisterPackage("example/shadowed", func() map[string]interface{} {
+		t.Error("registered package loaded")
+		return nil
+	})
+	in := New()
+	in.Import("example/shadowed", map[string]interface{}{"X": int64(1)})
+	mustEval(t, in, `(import "example/shadowed")`)
+	if v := mustEval(t, in, `shadowed.X`); v != int64(1) {
+		t.Errorf("shadowed.X = %v, want 1", v)
+	}
+}
@@ -1,24 +1,76 @@
 package lisp
 
-import "fmt"
+import (
+	"fmt"
+	"sync/atomic"
+)
 
 type scope struct {
 	data   map[sym]sexpr
 	parent *scope
+	interp *Interpreter
+
+	// The frames of lambdas and lets keep the variables they bind in
+	// numbered slots rather than in data. names[i] is the name of vals[i].
+	names []sym
+	vals  []sexpr
+
+	// The module or namespace whose top-level scope this is, if any. define
+	// does not reach past either of them.
+	module *module
+	ns     *namespace
 }
 
 func (s *scope) lookup(sy sym) sexpr {
+	v, ok := s.get(sy)
+	if !ok {
+		panic(fmt.Sprintf("undefined: %s", string(sy)))
+	}
+	return v
+}
+
+// get is like lookup, but reports whether sy is defined instead of panicking.
+func (s *scope) get(sy sym) (sexpr, bool) {
+	if i := s.slot(sy); i >= 0 {
+		return s.vals[i], true
+	}
 	v, ok := s.data[sy]
 	if ok {
-		return v
+		return v, true
 	}
 	if s.parent != nil {
-		return s.parent.lookup(sy)
+		return s.parent.get(sy)
 	}
-	panic(fmt.Sprintf("undefined: %s", string(sy)))
+	return s.interp.qualified(sy)
+}
+
+// slot returns the index of the slot named sy, or -1 if there is none.
+func (s *scope) slot(sy sym) int {
+	for i, name := range s.names {
+		if name == sy {
+			return i
+		}
+	}
+	return -1
+}
+
+// lookupFree looks up a variable that is not bound in any of the first depth
+// scopes of the chain starting at s, other than by define or import, which
+// add to the scopes' maps rather than their slots.
+func (s *scope) lookupFree(sy sym, depth int) sexpr {
+	for ; depth > 0; depth-- {
+		if v, ok := s.data[sy]; ok {
+			return v
+		}
+		s = s.parent
+	}
+	return s.lookup(sy)
 }
 
 func (s *scope) isDefinedHere(sy sym) bool {
+	if s.slot(sy) >= 0 {
+		return true
+	}
 	_, ok := s.data[sy]
 	return ok
 }
@@ -33,11 +85,46 @@ func (s *scope) isDefined(sy sym) bool {
 }
 
 func (s *scope) define(sy sym, val sexpr) {
+	if s.ns != nil && s.ns.protected {
+		panic(fmt.Sprintf("Cannot define %s in the protected namespace %s",
+			sy, s.ns.name))
+	}
+	s.set(sy, val)
+}
+
+// set binds sy to val in s, regardless of any namespace protection.
+func (s *scope) set(sy sym, val sexpr) {
+	old := s.data[sy]
+	i := s.slot(sy)
+	if i >= 0 {
+		old = s.vals[i]
+	}
+	if isSyntax(old) || isSyntax(val) {
+		atomic.AddUint64(&s.interp.syntaxGen, 1)
+	}
+	if i >= 0 {
+		s.vals[i] = val
+		return
+	}
+	if s.data == nil {
+		s.data = make(map[sym]sexpr)
+	}
 	s.data[sy] = val
 }
 
+// isSyntax reports whether v is a macro or primitive, which the compiler
+// expands or compiles in place of a call.
+func isSyntax(v sexpr) bool {
+	switch v.(type) {
+	case macro, primitive_t:
+		return true
+	}
+	return false
+}
+
 func (s *scope) defineHigh(sy sym, val sexpr) {
-	if s.parent == nil || s.isDefinedHere(sy) {
+	if s.parent == nil || s.module != nil || s.ns != nil ||
+		s.isDefinedHere(sy) {
 		s.define(sy, val)
 	} else {
 		s.parent.defineHigh(sy, val)
@@ -48,11 +135,18 @@ func (s *scope) String() string {
 	return fmt.Sprintf("%s\nPARENT:\n%s", s.data, s.parent)
 }
 
+// newScope creates an empty scope. Its map is only allocated once something is
+// defined in it.
 func newScope(parent *scope) *scope {
 	s := new(scope)
-	s.data = make(map[sym]sexpr)
 	s.parent = parent
+	s.interp = parent.interp
 	return s
 }
 
-var global *scope
+// newFrame creates the scope for a call to a lambda or the body of a let, with
+// the slots names bound to vals.
+func newFrame(parent *scope, names []sym, vals []sexpr) *scope {
+	return &scope{parent: parent, interp: parent.interp, names: names,
+		vals: vals}
+}
@@ -1,3 +1,391 @@
 package lisp
 
-// TODO
+import "fmt"
+
+const ellipsis = sym("...")
+
+// syntaxRules is a macro defined by syntax-rules, which rewrites the forms
+// matching one of its patterns according to the template of the pattern.
+//
+// Symbols that a template introduces, rather than takes from the form being
+// rewritten, are renamed to new symbols if the template binds them with let,
+// lambda or multiple-value-bind, or if they are not defined where the macro
+// is, so that variables the expansion binds cannot capture those of the
+// form. Other symbols keep their names, so they refer to whatever they are
+// bound to where the macro is used.
+type syntaxRules struct {
+	literals map[sym]bool
+	rules    []syntaxRule
+	env      *scope // the scope the macro was defined in
+}
+
+type syntaxRule struct {
+	pattern  sexpr // the pattern, without the macro keyword
+	template sexpr
+	binders  map[sym]bool // the symbols the template binds
+}
+
+// repeated is the value of a pattern variable that is followed by an
+// ellipsis: the values it takes in each repetition.
+type repeated []sexpr
+
+// (syntax-rules (literal...) ((_ pattern...) template)...)
+//
+// Returns a macro that rewrites a form to the template of the first rule
+// whose pattern it matches. A pattern is matched against the arguments of
+// the form: a symbol matches any form and binds it, except _, which binds
+// nothing, and literals, which match only themselves. A pattern followed by
+// ... matches any number of forms, and the template it is used in must
+// also be followed by ... to repeat for each of them.
+func primitiveSyntaxRules(sc *scope, ss []sexpr) sexpr {
+	if len(ss) == 0 {
+		panic("Invalid number of arguments")
+	}
+	lits, ok := listItems(ss[0])
+	if !ok {
+		panic("Invalid literals list")
+	}
+	sr := &syntaxRules{literals: make(map[sym]bool), env: sc}
+	for _, l := range lits {
+		s, ok := l.(sym)
+		if !ok {
+			panic(fmt.Sprintf("Expected a symbol, got %s", asString(l)))
+		}
+		sr.literals[s] = true
+	}
+	for _, r := range ss[1:] {
+		parts, ok := listItems(r)
+		if !ok || len(parts) != 2 {
+			panic(fmt.Sprintf("Invalid syntax rule %s", asString(r)))
+		}
+		p, ok := parts[0].(cons)
+		if !ok {
+			panic(fmt.Sprintf("Invalid pattern %s", asString(parts[0])))
+		}
+		binders := make(map[sym]bool)
+		templateBinders(parts[1], binders)
+		sr.rules = append(sr.rules, syntaxRule{p.cdr, parts[1], binders})
+	}
+	return macro{transform: sr.transform}
+}
+
+// (define-syntax name macro)
+//
+// Defines name as the macro that the expression macro evaluates to, such as
+// one made by syntax-rules.
+func primitiveDefineSyntax(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	name, ok := ss[0].(sym)
+	if !ok {
+		panic("Invalid argument")
+	}
+	m, ok := eval(sc, ss[1]).(macro)
+	if !ok {
+		panic("Expected a macro")
+	}
+	m.name = name
+	sc.defineHigh(name, m)
+	return Nil
+}
+
+func (sr *syntaxRules) transform(name sym, args []sexpr) sexpr {
+	form := unflatten(args)
+	for _, r := range sr.rules {
+		b := make(map[sym]sexpr)
+		if sr.match(r.pattern, form, b) {
+			renames := make(map[sym]sym)
+			for s := range r.binders {
+				if _, ok := b[s]; !ok {
+					renames[s] = sr.env.interp.gensym(string(s))
+				}
+			}
+			return sr.instantiate(r.template, b, renames, 0)
+		}
+	}
+	panic(macroError(cons{car: name, cdr: form},
+		fmt.Sprintf("No rule of %s macro matches its arguments", name)))
+}
+
+// sequence returns the items of the list or vector x and the tail of the
+// list after them. The tail of a vector is nil, and anything else is a tail
+// with no items before it.
+func sequence(x sexpr) (items []sexpr, tail sexpr) {
+	if v, ok := x.(*vector); ok {
+		return v.items, nil
+	}
+	for {
+		c, ok := x.(cons)
+		if !ok {
+			return items, x
+		}
+		items = append(items, c.car)
+		x = c.cdr
+	}
+}
+
+// match reports whether the form f matches the pattern p, adding the values
+// of the pattern variables of p to b.
+func (sr *syntaxRules) match(p, f sexpr, b map[sym]sexpr) bool {
+	switch p := p.(type) {
+	case sym:
+		if p == "_" {
+			return true
+		}
+		if sr.literals[p] {
+			return f == p
+		}
+		b[p] = f
+		return true
+	case cons, *vector:
+		_, isVector := p.(*vector)
+		if _, ok := f.(*vector); ok != isVector {
+			return false
+		}
+		if _, ok := f.(cons); !ok && !isVector && f != nil {
+			return false
+		}
+		pItems, pTail := sequence(p)
+		fItems, fTail := sequence(f)
+		return sr.matchItems(pItems, pTail, fItems, fTail, b)
+	case nil:
+		return f == nil
+	}
+	return equal(p, f)
+}
+
+// matchItems matches the items and tail of a list or vector form to those of
+// a pattern.
+func (sr *syntaxRules) matchItems(pItems []sexpr, pTail sexpr, fItems []sexpr,
+	fTail sexpr, b map[sym]sexpr) bool {
+	e := -1
+	for i, p := range pItems {
+		if p == ellipsis {
+			e = i
+			break
+		}
+	}
+	if e < 0 {
+		if len(fItems) < len(pItems) || (pTail == nil && len(fItems) > len(pItems)) {
+			return false
+		}
+		for i, p := range pItems {
+			if !sr.match(p, fItems[i], b) {
+				return false
+			}
+		}
+		if pTail == nil {
+			return fTail == nil
+		}
+		rest := fTail
+		for i := len(fItems) - 1; i >= len(pItems); i-- {
+			rest = cons{car: fItems[i], cdr: rest}
+		}
+		return sr.match(pTail, rest, b)
+	}
+
+	if e == 0 {
+		panic("Ellipsis at the start of a pattern")
+	}
+	pre, rep, post := pItems[:e-1], pItems[e-1], pItems[e+1:]
+	n := len(fItems) - len(pre) - len(post)
+	if n < 0 || pTail != nil || fTail != nil {
+		return false
+	}
+	for i, p := range pre {
+		if !sr.match(p, fItems[i], b) {
+			return false
+		}
+	}
+	vars := sr.patternVars(rep, nil)
+	seqs := make(map[sym]repeated, len(vars))
+	for _, f := range fItems[len(pre) : len(pre)+n] {
+		bi := make(map[sym]sexpr)
+		if !sr.match(rep, f, bi) {
+			return false
+		}
+		for _, v := range vars {
+			seqs[v] = append(seqs[v], bi[v])
+		}
+	}
+	for _, v := range vars {
+		b[v] = seqs[v]
+	}
+	for i, p := range post {
+		if !sr.match(p, fItems[len(pre)+n+i], b) {
+			return false
+		}
+	}
+	return true
+}
+
+// templateBinders adds the symbols that the template t binds with let,
+// lambda or multiple-value-bind to binders.
+func templateBinders(t sexpr, binders map[sym]bool) {
+	items, tail := sequence(t)
+	if len(items) == 0 {
+		return
+	}
+	if len(items) > 1 {
+		switch items[0] {
+		case sym("let"):
+			if bindings, ok := listItems(items[1]); ok {
+				for _, b := range bindings {
+					if c, ok := b.(cons); ok {
+						addSyms(c.car, binders)
+					}
+				}
+			}
+		case sym("lambda"), sym("multiple-value-bind"):
+			addSyms(items[1], binders)
+		}
+	}
+	for _, x := range items {
+		templateBinders(x, binders)
+	}
+	templateBinders(tail, binders)
+}
+
+// addSyms adds the symbols of the parameter list params to syms.
+func addSyms(params sexpr, syms map[sym]bool) {
+	switch p := params.(type) {
+	case sym:
+		if p != ellipsis {
+			syms[p] = true
+		}
+	case cons:
+		addSyms(p.car, syms)
+		addSyms(p.cdr, syms)
+	}
+}
+
+// patternVars appends the pattern variables of p to vars.
+func (sr *syntaxRules) patternVars(p sexpr, vars []sym) []sym {
+	switch p := p.(type) {
+	case sym:
+		if p != "_" && p != ellipsis && !sr.literals[p] {
+			vars = append(vars, p)
+		}
+	case cons, *vector:
+		items, tail := sequence(p)
+		for _, x := range items {
+			vars = sr.patternVars(x, vars)
+		}
+		vars = sr.patternVars(tail, vars)
+	}
+	return vars
+}
+
+// instantiate returns the template t with the pattern variables in b
+// replaced by their values, and the symbols it introduces renamed as given by
+// renames, to which new renamings are added.
+//
+// level tells whether t is code, 0, or data: quoted, -1, or part of a
+// quasiquote template nested level deep. Only symbols in code are renamed,
+// so that the template can introduce symbols as data, as in (list 'x).
+func (sr *syntaxRules) instantiate(t sexpr, b map[sym]sexpr,
+	renames map[sym]sym, level int) sexpr {
+	switch t := t.(type) {
+	case sym:
+		if v, ok := b[t]; ok {
+			if _, ok := v.(repeated); ok {
+				panic(fmt.Sprintf("Pattern variable %s is used without an ellipsis", t))
+			}
+			return v
+		}
+		if level != 0 {
+			return t
+		}
+		if r, ok := renames[t]; ok {
+			return r
+		}
+		if _, ok := sr.env.get(t); ok {
+			return t
+		}
+		r := sr.env.interp.gensym(string(t))
+		renames[t] = r
+		return r
+	case cons, *vector:
+		items, tail := sequence(t)
+		inner := level
+		if c, ok := t.(cons); ok {
+			inner = sr.quoteLevel(c.car, b, level)
+		}
+		var out []sexpr
+		for i := 0; i < len(items); i++ {
+			l := inner
+			if i == 0 {
+				l = level
+			}
+			if i+1 < len(items) && items[i+1] == ellipsis {
+				out = append(out, sr.repeat(items[i], b, renames, l)...)
+				i++
+				continue
+			}
+			out = append(out, sr.instantiate(items[i], b, renames, l))
+		}
+		if _, ok := t.(*vector); ok {
+			return &vector{out}
+		}
+		res := sr.instantiate(tail, b, renames, inner)
+		for i := len(out) - 1; i >= 0; i-- {
+			res = cons{car: out[i], cdr: res}
+		}
+		return res
+	}
+	return t
+}
+
+// quoteLevel returns the level, as for instantiate, of the arguments of a
+// template form with the head head at level level.
+func (sr *syntaxRules) quoteLevel(head sexpr, b map[sym]sexpr, level int) int {
+	s, ok := head.(sym)
+	if _, isVar := b[s]; !ok || isVar {
+		return level
+	}
+	switch {
+	case s == "quote" && level == 0:
+		return -1
+	case s == "quasiquote" && level >= 0:
+		return level + 1
+	case (s == "unquote" || s == "unquote-splicing") && level > 0:
+		return level - 1
+	}
+	return level
+}
+
+// repeat instantiates the template t, which is followed by an ellipsis, once
+// for each of the values of the repeated pattern variables in it.
+func (sr *syntaxRules) repeat(t sexpr, b map[sym]sexpr,
+	renames map[sym]sym, level int) []sexpr {
+	var vars []sym
+	n := -1
+	for _, v := range sr.patternVars(t, nil) {
+		seq, ok := b[v].(repeated)
+		if !ok {
+			continue
+		}
+		if n >= 0 && len(seq) != n {
+			panic("Pattern variables under one ellipsis matched different " +
+				"numbers of forms")
+		}
+		n = len(seq)
+		vars = append(vars, v)
+	}
+	if n < 0 {
+		panic(fmt.Sprintf("No pattern variable to repeat in %s", asString(t)))
+	}
+	out := make([]sexpr, n)
+	for i := range out {
+		bi := make(map[sym]sexpr, len(b))
+		for k, v := range b {
+			bi[k] = v
+		}
+		for _, v := range vars {
+			bi[v] = b[v].(repeated)[i]
+		}
+		out[i] = sr.instantiate(t, bi, renames, level)
+	}
+	return out
+}
@@ -2,21 +2,28 @@ package lisp
 
 import (
 	"fmt"
+	"math/big"
+	"strconv"
 	"strings"
 )
 
 type cons struct {
 	car sexpr
 	cdr sexpr
+	pos *Pos // where the cons was read from, if known
 }
 
 type sexpr interface{}
 type atom interface{}
 type sym string
+type keyword string // a self-evaluating :name, held without the colon
 type function func(*scope, []sexpr) sexpr
 
 type native interface{}
 
+// Value is a Lisp value as seen by Go code.
+type Value interface{}
+
 func (v cons) String() string {
 	return fmt.Sprintf("(%s . %s)", asString(v.car), asString(v.cdr))
 }
@@ -35,12 +42,35 @@ func asString(v sexpr) string {
 		return v.String()
 	case sym:
 		return string(v)
+	case keyword:
+		return ":" + string(v)
+	case goType:
+		return v.String()
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case *big.Int:
+		return v.String()
+	case *big.Rat:
+		return v.RatString()
 	case float64:
-		return fmt.Sprintf("%G", v)
+		return formatFloat(v)
+	case complex128:
+		return formatComplex(v)
 	case string:
 		return fmt.Sprintf("\"%s\"", v)
+	case *hashMap:
+		return v.String()
+	case *vector:
+		return v.String()
+	case *multipleValues:
+		return v.String()
 	case function:
 		return "<func>"
+	case *lambda:
+		if v.name == "" {
+			return "<func>"
+		}
+		return fmt.Sprintf("<func: %s>", v.name)
 	case primitive_t:
 		return fmt.Sprintf("<primitive: %s>", v.name)
 	case macro:
@@ -54,8 +84,11 @@ func asString(v sexpr) string {
 }
 
 func isFunction(s sexpr) bool {
-	_, ok := s.(function)
-	return ok
+	switch s.(type) {
+	case function, *lambda:
+		return true
+	}
+	return false
 }
 
 func isPrimitive(s sexpr) bool {
@@ -0,0 +1,95 @@
+package lisp
+
+import "strings"
+
+// multipleValues holds the results of a form that returns other than one
+// value, such as a call to a Go function with several results. They are
+// taken apart with call-with-values or multiple-value-bind; anywhere else a
+// single value is expected, the first one is used.
+type multipleValues struct {
+	vals []sexpr
+}
+
+func (m *multipleValues) String() string {
+	var b strings.Builder
+	b.WriteString("(values")
+	for _, v := range m.vals {
+		b.WriteString(" " + asString(v))
+	}
+	b.WriteString(")")
+	return b.String()
+}
+
+// makeValues returns vals as the result of a form: a single value as it is,
+// and any other number of values as multipleValues.
+func makeValues(vals []sexpr) sexpr {
+	if len(vals) == 1 {
+		return vals[0]
+	}
+	return &multipleValues{vals}
+}
+
+// primary returns the first of the values v of a form, or nil if there are
+// none. Forms that take a single value, such as the arguments of a call, use
+// it, so only call-with-values and multiple-value-bind see any other values.
+func primary(v sexpr) sexpr {
+	if m, ok := v.(*multipleValues); ok {
+		if len(m.vals) == 0 {
+			return Nil
+		}
+		return m.vals[0]
+	}
+	return v
+}
+
+// valuesOf returns the values making up the result v of a form.
+func valuesOf(v sexpr) []sexpr {
+	if m, ok := v.(*multipleValues); ok {
+		return m.vals
+	}
+	return []sexpr{v}
+}
+
+// (values expr...)
+//
+// Returns each of its arguments as a separate value.
+func builtinValues(sc *scope, ss []sexpr) sexpr {
+	vals := make([]sexpr, len(ss))
+	copy(vals, ss)
+	return makeValues(vals)
+}
+
+// (call-with-values producer consumer)
+//
+// Calls producer with no arguments and then consumer with the values it
+// returned as arguments.
+func builtinCallWithValues(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	v := apply(sc, ss[0], []sexpr{})
+	return apply(sc, ss[1], valuesOf(v))
+}
+
+// (multiple-value-bind (sym1 ...) expr body...)
+//
+// Evaluates body with the symbols bound to the values of expr. Symbols
+// without a value are bound to nil, and extra values are ignored.
+func primitiveMultipleValueBind(sc *scope, ss []sexpr) (*scope, sexpr) {
+	if len(ss) < 2 {
+		panic("Invalid number of arguments")
+	}
+	params := flatten(ss[0])
+	names := make([]sym, len(params))
+	for i, p := range params {
+		s, ok := p.(sym)
+		if !ok {
+			panic("Invalid binding")
+		}
+		names[i] = s
+	}
+	vals := valuesOf(eval(sc, ss[1]))
+	bound := make([]sexpr, len(names))
+	copy(bound, vals)
+	return primitiveBegin(letFrame(sc, names, bound), ss[2:])
+}
@@ -0,0 +1,85 @@
+package lisp
+
+import (
+	"strconv"
+	"testing"
+)
+
+var valuesTests = []struct {
+	src  string
+	want string
+}{
+	{`(values 1 2)`, `(values 1 2)`},
+	{`(values)`, `(values)`},
+	{`(values 1)`, `1`},
+	{`(call-with-values (lambda () (values 1 2)) +)`, `3`},
+	{`(call-with-values (lambda () 5) list)`, `(5)`},
+	{`(multiple-value-bind (a b) (values 1 2) (list b a))`, `(2 1)`},
+	{`(multiple-value-bind (a b c) (values 1 2) (list a b c))`, `(1 2 nil)`},
+	{`(multiple-value-bind (a) (values 1 2) a)`, `1`},
+	{`(multiple-value-bind () 1)`, `nil`},
+	{`(strconv.Atoi "42")`, `(values 42 nil)`},
+	{`(multiple-value-bind (n err) (strconv.Atoi "x") (list n (nil? err)))`,
+		`(0 nil)`},
+	{`(+ 1 (strconv.Atoi "4"))`, `5`},
+	{`((lambda (s) (+ 1 (strconv.Atoi s))) "4")`, `5`},
+	{`(list (values 1 2) (values))`, `(1 nil)`},
+	{`[(strconv.Atoi "4")]`, `[4]`},
+	{`(let ((n (strconv.Atoi "4"))) n)`, `4`},
+	{`((lambda () (let ((n (strconv.Atoi "4"))) n)))`, `4`},
+	{`(begin (define n (strconv.Atoi "7")) n)`, `7`},
+	{`(if (values nil 1) 'yes 'no)`, `no`},
+	{`((lambda () (if (values nil 1) 'yes 'no)))`, `no`},
+	{`(go.nothing)`, `nil`},
+	{`(go.pair (lambda () (values 1 2)))`, `3`},
+	{`(go.inc (lambda (n) (values (+ n 1) 'ignored)))`, `2`},
+}
+
+func TestValues(t *testing.T) {
+	in := New()
+	in.Define("strconv.Atoi", strconv.Atoi)
+	in.Define("nil?", func(x interface{}) bool { return x == nil })
+	in.Define("go.nothing", func() {})
+	in.Define("go.inc", func(f func(int) int) int { return f(1) })
+	in.Define("go.pair", func(f func() (int, int)) int {
+		a, b := f()
+		return a + b
+	})
+	for _, test := range valuesTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestPanicOnGoError(t *testing.T) {
+	in := New()
+	in.PanicOnGoError(true)
+	in.Define("strconv.Atoi", strconv.Atoi)
+	in.Define("go.check", func(fail bool) error {
+		if fail {
+			return strconv.ErrRange
+		}
+		return nil
+	})
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`(+ (strconv.Atoi "41") 1)`, `42`},
+		{`(go.check false)`, `nil`},
+		{`(recover '(_) (lambda () (strconv.Atoi "x")) (lambda (e) 'caught))`,
+			`caught`},
+	}
+	for _, test := range tests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+	_, err := in.Eval(`(go.check true)`)
+	if err == nil || err.(*Error).Value != strconv.ErrRange {
+		t.Errorf("got %v, want %v", err, strconv.ErrRange)
+	}
+}
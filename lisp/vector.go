@@ -0,0 +1,162 @@
+package lisp
+
+import "strings"
+
+// A vector is a mutable, fixed-length sequence of Lisp values with constant
+// time indexing. Vectors are written [item ...] and, like maps, evaluate to a
+// new vector of the values of their items.
+type vector struct {
+	items []sexpr
+}
+
+func (v *vector) String() string {
+	strs := make([]string, len(v.items))
+	for i, x := range v.items {
+		strs[i] = asString(x)
+	}
+	return "[" + strings.Join(strs, " ") + "]"
+}
+
+// equal reports whether v and w have equal items.
+func (v *vector) equal(w *vector) bool {
+	if len(v.items) != len(w.items) {
+		return false
+	}
+	for i, x := range v.items {
+		if !equal(x, w.items[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// evalVector returns a new vector holding the values of the items of v.
+func evalVector(sc *scope, v *vector) *vector {
+	items := make([]sexpr, len(v.items))
+	for i, x := range v.items {
+		items[i] = primary(eval(sc, x))
+	}
+	return &vector{items}
+}
+
+// vectorArg returns s as a vector, panicking if it is not one.
+func vectorArg(s sexpr) *vector {
+	v, ok := s.(*vector)
+	if !ok {
+		panic("Invalid argument")
+	}
+	return v
+}
+
+// indexArg returns s as an index into a sequence of length n. end tells
+// whether s may also be n itself, as the end of a slice may.
+func indexArg(s sexpr, n int, end bool) int {
+	i, ok := s.(int64)
+	if !ok {
+		panic("Invalid argument")
+	}
+	if i < 0 || i > int64(n) || (i == int64(n) && !end) {
+		panic("Index out of range")
+	}
+	return int(i)
+}
+
+// (vector item...)
+//
+// Returns a new vector of the given items.
+func builtinVector(sc *scope, ss []sexpr) sexpr {
+	items := make([]sexpr, len(ss))
+	copy(items, ss)
+	return &vector{items}
+}
+
+// (vector? expr)
+//
+// Tells whether the given expression is a vector.
+func builtinIsVector(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	_, ok := ss[0].(*vector)
+	return ok
+}
+
+// (vector-ref v i)
+func builtinVectorRef(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 {
+		panic("Invalid number of arguments")
+	}
+	v := vectorArg(ss[0])
+	return v.items[indexArg(ss[1], len(v.items), false)]
+}
+
+// (vector-set! v i x)
+func builtinVectorSet(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	v := vectorArg(ss[0])
+	v.items[indexArg(ss[1], len(v.items), false)] = ss[2]
+	return Nil
+}
+
+// (vector-length v)
+func builtinVectorLength(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return int64(len(vectorArg(ss[0]).items))
+}
+
+// (vector-append v...)
+//
+// Returns a new vector of the items of all the given vectors.
+func builtinVectorAppend(sc *scope, ss []sexpr) sexpr {
+	var items []sexpr
+	for _, s := range ss {
+		items = append(items, vectorArg(s).items...)
+	}
+	return &vector{items}
+}
+
+// (vector-slice v start [end])
+//
+// Returns a new vector of the items of v from index start up to but not
+// including index end, which defaults to the length of v.
+func builtinVectorSlice(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 2 && len(ss) != 3 {
+		panic("Invalid number of arguments")
+	}
+	v := vectorArg(ss[0])
+	start := indexArg(ss[1], len(v.items), true)
+	end := len(v.items)
+	if len(ss) == 3 {
+		end = indexArg(ss[2], len(v.items), true)
+	}
+	if start > end {
+		panic("Index out of range")
+	}
+	items := make([]sexpr, end-start)
+	copy(items, v.items[start:end])
+	return &vector{items}
+}
+
+// (vector->list v)
+func builtinVectorToList(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	return unflatten(vectorArg(ss[0]).items)
+}
+
+// (list->vector ls)
+func builtinListToVector(sc *scope, ss []sexpr) sexpr {
+	if len(ss) != 1 {
+		panic("Invalid number of arguments")
+	}
+	items, ok := listItems(ss[0])
+	if !ok {
+		panic("Invalid argument")
+	}
+	return &vector{items}
+}
@@ -0,0 +1,77 @@
+package lisp
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var vectorTests = []struct {
+	src  string
+	want string
+}{
+	{`[]`, `[]`},
+	{`[1 (+ 1 1) "three"]`, `[1 2 "three"]`},
+	{`'[a (b c)]`, `[a (b c)]`},
+	{`(vector 1 'a)`, `[1 a]`},
+	{`(vector-ref [10 20 30] 1)`, `20`},
+	{`(let ((v (vector 1 2 3)))
+		(begin (vector-set! v 0 'x) v))`, `[x 2 3]`},
+	{`(vector-length [1 2 3])`, `3`},
+	{`(vector-append [1] [] [2 3])`, `[1 2 3]`},
+	{`(vector-slice [0 1 2 3] 1 3)`, `[1 2]`},
+	{`(vector-slice [0 1 2 3] 2)`, `[2 3]`},
+	{`(vector-slice [0 1 2 3] 4)`, `[]`},
+	{`(vector->list [1 2])`, `(1 2)`},
+	{`(list->vector '(1 2))`, `[1 2]`},
+	{`(equal? [1 [2]] (vector 1 (vector 2)))`, `true`},
+	{`(equal? [1 2] [1 2 3])`, `nil`},
+	{`(vector? [])`, `true`},
+	{`(vector? '())`, `false`},
+	{`(let ((f (lambda () [1])))
+		(begin (vector-set! (f) 0 2) (f)))`, `[1]`},
+	{`(strings.Split "a,b,c" ",")`, `["a" "b" "c"]`},
+	{`(strings.Join ["a" "b"] "-")`, `"a-b"`},
+	{`(strings.Join '("a" "b") "+")`, `"a+b"`},
+	{`(go.sum [1 2 3])`, `6`},
+	{`(go.pair)`, `[1 2]`},
+}
+
+func TestVector(t *testing.T) {
+	in := New()
+	in.Define("strings.Split", strings.Split)
+	in.Define("strings.Join", strings.Join)
+	in.Define("go.sum", func(a [3]int) int { return a[0] + a[1] + a[2] })
+	in.Define("go.pair", func() [2]uint8 { return [2]uint8{1, 2} })
+	for _, test := range vectorTests {
+		v := mustEval(t, in, test.src)
+		if s := asString(v); s != test.want {
+			t.Errorf("%s = %s, want %s", test.src, s, test.want)
+		}
+	}
+}
+
+func TestVectorToGo(t *testing.T) {
+	in := New()
+	var got [][]float64
+	in.Define("go.take", func(x [][]float64) { got = x })
+	mustEval(t, in, `(go.take [[1 1.5] []])`)
+	want := [][]float64{{1, 1.5}, {}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestVectorErrors(t *testing.T) {
+	in := New()
+	in.Define("go.sum", func(a [3]int) int { return a[0] + a[1] + a[2] })
+	for _, src := range []string{
+		`(vector-ref [1] 1)`, `(vector-ref [1] -1)`, `(vector-ref [1] 0.0)`,
+		`(vector-ref '(1) 0)`, `(vector-slice [1 2] 2 1)`, `(go.sum [1 2])`,
+		`[1`, `]`,
+	} {
+		if _, err := in.Eval(src); err == nil {
+			t.Errorf("%s: expected an error", src)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package lisp
+
+// A vmFrame is the state of one active call to a compiled lambda.
+type vmFrame struct {
+	fn *lambda
+	c  *code
+	pc int
+	sc *scope
+}
+
+// run calls the lambda l, compiled to c, with the already evaluated arguments
+// ss.
+//
+// Calls from compiled code to other compiled lambdas push a frame onto the
+// VM's own stack rather than recursing in Go, and tail calls replace the
+// calling frame.
+func (l *lambda) run(c *code, ss []sexpr) sexpr {
+	frames := []vmFrame{{l, c, 0, l.bind(ss)}}
+	f := &frames[0]
+	var stack []sexpr
+
+	defer func() {
+		if r := recover(); r != nil {
+			var err *Error
+			for i := len(frames) - 1; i >= 0; i-- {
+				f := &frames[i]
+				err = wrapError(r, f.c.forms[f.pc-1])
+				wrapCall(err, f.fn)
+				r = err
+			}
+			panic(err)
+		}
+	}()
+
+	for {
+		in := f.c.instrs[f.pc]
+		f.pc++
+		switch in.op {
+		case opConst:
+			stack = append(stack, f.c.consts[in.a])
+
+		case opLocal:
+			sc := f.sc
+			for i := 0; i < in.b; i++ {
+				sc = sc.parent
+			}
+			stack = append(stack, sc.vals[in.a])
+
+		case opLookup:
+			s := f.c.consts[in.a].(sym)
+			stack = append(stack, f.sc.lookupFree(s, in.b))
+
+		case opPop:
+			stack = stack[:len(stack)-1]
+
+		case opJump:
+			f.pc = in.a
+
+		case opJumpFalse:
+			v := primary(stack[len(stack)-1])
+			stack = stack[:len(stack)-1]
+			if !IsTrue(v) {
+				f.pc = in.a
+			}
+
+		case opOperator:
+			op := stack[len(stack)-1]
+			switch op.(type) {
+			case primitive_t, macro:
+				form := f.c.consts[in.a].(cons)
+				stack[len(stack)-1] = applyOperator(f.sc, op, flatten(form.cdr))
+				f.pc = in.b
+			}
+
+		case opCall, opTailCall:
+			n := in.a
+			fn := stack[len(stack)-n-1]
+			args := make([]sexpr, n)
+			for i, v := range stack[len(stack)-n:] {
+				args[i] = primary(v)
+			}
+			stack = stack[:len(stack)-n-1]
+
+			var c *code
+			g, ok := fn.(*lambda)
+			if ok {
+				c = g.compiled()
+			}
+			if c != nil {
+				next := vmFrame{g, c, 0, g.bind(args)}
+				if in.op == opTailCall {
+					*f = next
+				} else {
+					frames = append(frames, next)
+					f = &frames[len(frames)-1]
+				}
+				continue
+			}
+			// Anything else is called from Go. In tail position only
+			// jumps, opUnlets and the opReturn follow, so the result
+			// can simply be pushed.
+			stack = append(stack, apply(f.sc, fn, args))
+
+		case opReturn:
+			v := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if len(frames) == 1 {
+				return v
+			}
+			frames = frames[:len(frames)-1]
+			f = &frames[len(frames)-1]
+			stack = append(stack, v)
+
+		case opDefine:
+			v := primary(stack[len(stack)-1])
+			s := f.c.consts[in.a].(sym)
+			if l, ok := v.(*lambda); ok && l.name == "" {
+				// name the function for backtraces
+				l.name = s
+			}
+			f.sc.defineHigh(s, v)
+			stack[len(stack)-1] = Nil
+
+		case opLambda:
+			lf := f.c.consts[in.a].(*lambdaForm)
+			stack = append(stack, &lambda{params: lf.params, body: lf.body,
+				env: f.sc, proc: lf.proc})
+
+		case opEval:
+			stack = append(stack, eval(f.sc, f.c.consts[in.a]))
+
+		case opLet:
+			names := f.c.consts[in.a].([]sym)
+			vals := make([]sexpr, len(names))
+			for i, v := range stack[len(stack)-len(names):] {
+				vals[i] = primary(v)
+			}
+			stack = stack[:len(stack)-len(names)]
+			f.sc = newFrame(f.sc, names, vals)
+
+		case opUnlet:
+			f.sc = f.sc.parent
+		}
+	}
+}
+
+// applyOperator applies a primitive or macro found in operator position to
+// the unevaluated arguments ss, as eval does.
+func applyOperator(sc *scope, op sexpr, ss []sexpr) sexpr {
+	switch f := op.(type) {
+	case primitive_t:
+		if f.tail != nil {
+			return eval(f.tail(sc, ss))
+		}
+		return f.f(sc, ss)
+	case macro:
+		return eval(sc, f.expand(ss))
+	}
+	panic("Attempted application on something other than a primitive " +
+		"or macro")
+}
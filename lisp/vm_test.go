@@ -0,0 +1,135 @@
+package lisp
+
+import (
+	"strings"
+	"testing"
+)
+
+// Programs whose results must not depend on whether lambdas are compiled.
+var vmTests = []struct {
+	src  string
+	want string
+}{
+	{`((lambda (x y) (+ x y)) 1 2)`, "3"},
+	{`((lambda (x . rest) rest) 1 2 3)`, "(2 3)"},
+	{`((lambda args args) 1 2)`, "(1 2)"},
+	{`(begin
+		(define make-adder (lambda (n) (lambda (x) (+ x n))))
+		((make-adder 2) 3))`, "5"},
+	{`((lambda (x) (begin (define x 5) x)) 1)`, "5"},
+	{`((lambda (x) (let ((x 2) (y x)) (list x y))) 1)`, "(2 1)"},
+	{`((lambda (x) (eval 'x)) 7)`, "7"},
+	{`((lambda (op) (op 1 'yes 'no)) if)`, "yes"},
+	{`((lambda (x) (if x 'a)) nil)`, "nil"},
+	{`((lambda () (quote (a b))))`, "(a b)"},
+	{`(begin
+		(define f (lambda (x) (twice x)))
+		(defmacro twice (x) (list '* 2 x))
+		(f 4))`, "8"},
+	{`(begin
+		(defmacro twice (x) (list '* 2 x))
+		(define f (lambda (x) (twice x)))
+		(define before (f 4))
+		(defmacro twice (x) (list '+ x x 1))
+		(list before (f 4)))`, "(8 9)"},
+	{`(begin
+		(define-syntax swap (syntax-rules () ((_ a b) (list b a))))
+		(define f (lambda () (swap 1 2)))
+		(define before (f))
+		(define swap (lambda (a b) 'function))
+		(list before (f)))`, "((2 1) function)"},
+	{`(begin
+		(define count (lambda (n acc)
+			(if (= n 0) acc (count (- n 1) (cons n acc)))))
+		(count 3 nil))`, "(1 2 3)"},
+	{`(begin
+		(define fib (lambda (n)
+			(if (< n 2) 1 (+ (fib (- n 1)) (fib (- n 2))))))
+		(fib 10))`, "89"},
+	{`((lambda (f) (recover '(oops) (lambda () (f)) (lambda (e) e)))
+		(lambda () (panic 'oops)))`, "oops"},
+
+	// lexical addresses
+	{`((lambda (a b)
+		(let ((c 3))
+			((lambda (d) (list a b c d)) 4))) 1 2)`, "(1 2 3 4)"},
+	{`((lambda (x) (let ((x 2)) ((lambda () x)))) 1)`, "2"},
+	{`((lambda (x) (begin ((lambda () (define x 9))) x)) 1)`, "9"},
+	{`((lambda (x) (begin (let ((y 2)) (define x y)) x)) 1)`, "2"},
+	{`((lambda (x x) x) 1 2)`, "2"},
+	{`((lambda (x) (let ((y 1) (y 2)) (list x y))) 0)`, "(0 2)"},
+	{`(begin
+		(define g (lambda () free))
+		(define free 'late)
+		(g))`, "late"},
+}
+
+func TestVM(t *testing.T) {
+	for _, compile := range []bool{false, true} {
+		for _, test := range vmTests {
+			in := New()
+			in.compile = compile
+			v, err := in.Eval(test.src)
+			if err != nil {
+				t.Errorf("compile=%v: %s: %s", compile, test.src, err)
+			} else if asString(v) != test.want {
+				t.Errorf("compile=%v: %s = %s, want %s", compile,
+					test.src, asString(v), test.want)
+			}
+		}
+	}
+}
+
+func TestVMErrors(t *testing.T) {
+	for _, compile := range []bool{false, true} {
+		in := New()
+		in.compile = compile
+		in.Exec(strings.NewReader(`
+			(define g (lambda (x) (+ 1 (car x))))
+			(define f (lambda (x) (+ 1 (g x))))
+			(define h (lambda (x y) x))`))
+		_, err := in.Eval("(f 5)")
+		want := "2:31: Invalid argument in (car x)"
+		if err == nil || err.Error() != want {
+			t.Errorf("compile=%v: got %v, want %s", compile, err, want)
+			continue
+		}
+		e := err.(*Error)
+		bt := e.BacktraceString()
+		wantBt := "0: g: (car x) at 2:31\n" +
+			"1: f: (g x) at 3:31\n" +
+			"2: (f 5) at 1:1"
+		if bt != wantBt {
+			t.Errorf("compile=%v: backtrace\n%s\nwant\n%s", compile, bt,
+				wantBt)
+		}
+		_, err = in.Eval("(h 1)")
+		if err == nil || err.(*Error).Value != "Invalid number of arguments" {
+			t.Errorf("compile=%v: (h 1) gave %v", compile, err)
+		}
+	}
+}
+
+const fibSrc = `(define fib
+  (lambda (n)
+    (if (< n 2) 1
+      (+
+        (fib (- n 1))
+        (fib (- n 2))))))`
+
+func benchmarkFib(b *testing.B, compile bool) {
+	in := New()
+	in.compile = compile
+	if err := in.Exec(strings.NewReader(fibSrc)); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := in.Eval("(fib 15)"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFibTreeWalker(b *testing.B) { benchmarkFib(b, false) }
+func BenchmarkFibVM(b *testing.B)         { benchmarkFib(b, true) }
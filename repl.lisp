@@ -18,11 +18,14 @@
           (lambda ()
             (for 1
               (recover '(_)
-                (lambda () (print (eval (readSexpr))))
-                (lambda (e)
+                (lambda () (print (eval (readSexpr) (current-ns))))
+                (lambda (e err)
                   (if (equal? e 'eof)
                     (panic e)
-                    (fmt.Println e))))))
+                    (begin
+                      (fmt.Println e)
+                      (map fmt.Println (backtrace err))
+                      nil))))))
           (lambda (_)
             (fmt.Println "Bye!")))))))
 
@@ -1,29 +1,60 @@
+// Command scanpkgs generates bindings that make the exported identifiers of
+// Go packages importable from kakapo. Each package is registered with
+// lisp.RegisterPackage when the program starts, and only loaded once it is
+// imported.
+//
+// By default it scans the standard library. configure writes it to the
+// stdlib directory, one file per package:
+//
+//	scanpkgs -dir stdlib -package stdlib
+//
+// With -pkg, it generates bindings for the given packages instead, so that
+// any Go package can be made importable:
+//
+//	scanpkgs -pkg example.com/our/api -o bindings.go
+//
+// Packages are loaded from source with go/importer and go/types, so the
+// output follows the installed Go toolchain, the GOOS/GOARCH it builds for
+// and the build tags given with -tags.
+//
+// Each file written with -dir is given a build constraint, so that the
+// packages compiled in can be chosen with build tags: kakapo_no_<pkg> leaves
+// a package out, and kakapo_nostd leaves out every package except those
+// named with kakapo_<pkg>. <pkg> is the import path with "/", "." and "-"
+// replaced by "_", as in kakapo_no_net_http.
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
-	"io/ioutil"
+	"go/build"
+	"go/constant"
+	"go/format"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"io/fs"
+	"math"
 	"os"
-	"os/exec"
-	"path"
-	"regexp"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strconv"
 	"strings"
-	"unicode"
 )
 
-var importable = regexp.MustCompile(`^(func|const|var|type) @""\.`)
-var fM = regexp.MustCompile(`^func @`)
-var cM = regexp.MustCompile(`^const @`)
-var vM = regexp.MustCompile(`^var @`)
-var tM = regexp.MustCompile(`^type @`)
-var first = regexp.MustCompile(`( |\().*`)
-
 var (
 	ignorePkgs = []string{
 		"testing",
-		"old/",
+		"builtin",
+		"unsafe",
+		"cmd/",
+		"syscall/js",
+
+		// These register HTTP handlers when imported.
+		"expvar",
+		"net/http/pprof",
 	}
 )
 
@@ -37,178 +68,341 @@ const (
 type item struct {
 	kind int
 	name string
-	full string
+	expr string // the Go expression for a constant
+}
+
+// stringList is a flag that may be given several times, each time with a
+// comma-separated list.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(s string) error {
+	for _, x := range strings.Split(s, ",") {
+		if x != "" {
+			*l = append(*l, x)
+		}
+	}
+	return nil
+}
+
+var (
+	pkgPaths stringList
+	tags     stringList
+	output   = flag.String("o", "", "Write the bindings to `file` instead of stdout")
+	dir      = flag.String("dir", "",
+		"Write the bindings to one file per package in `directory`")
+	pkgName = flag.String("package", "main",
+		"Package `name` of the generated files")
+)
+
+func init() {
+	flag.Var(&pkgPaths, "pkg", "Generate bindings for the package at import `path` "+
+		"instead of the standard library; may be repeated")
+	flag.Var(&tags, "tags", "Comma-separated build `tags` to load packages with")
 }
 
 func main() {
-	fmt.Println(`package main
+	flag.Parse()
+	build.Default.BuildTags = tags
 
-import . "reflect"`)
+	fset := token.NewFileSet()
+	imp := importer.ForCompiler(fset, "source", nil).(types.ImporterFrom)
 
-	// find GO(1)
-	findGo()
+	// Packages are looked up from the current directory, so that packages
+	// of the module being worked on can be found.
+	cwd, err := os.Getwd()
+	if err != nil {
+		fail(err)
+	}
 
-	goroot := runtime.GOROOT()
-	pkgDir := path.Join(goroot, "pkg", runtime.GOOS + "_" + runtime.GOARCH)
+	names := pkgPaths
+	if len(names) == 0 {
+		names = stdPackages()
+	}
 
-	pkgs := make(map[string][]item)
 	fmt.Fprint(os.Stderr, "Scanning for packages...")
-	readPackages("", pkgDir, pkgs)
-
-	fmt.Println("import (")
-	for name, ss := range pkgs {
-		if len(ss) == 0 {
+	var pkgs []scanned
+	for _, name := range names {
+		pkg, err := imp.ImportFrom(name, cwd, 0)
+		if err != nil {
+			if len(pkgPaths) > 0 {
+				fail(err)
+			}
+			fmt.Fprintf(os.Stderr, "\nskipping %s: %v\n", name, err)
 			continue
 		}
-		iName := escapePkgName(name)
-		fmt.Printf("\t%s \"%s\"\n", iName, name)
-	}
-	fmt.Println(")")
-
-	fmt.Println("var _go_imports = map[string]map[string]interface{} {")
-	for name, ss := range pkgs {
-		iName := escapePkgName(name)
-		fmt.Printf("\"%s\": map[string]interface{} {\n", name)
-		for _, i := range ss {
-			if i.kind == CONST {
-				if isInt(i.full) {
-					fmt.Printf("%s: int64(%s.%s),\n", strconv.Quote(i.name), iName, i.name)
-				} else if isUint(i.full) {
-					fmt.Printf("%s: uint64(%s.%s),\n", strconv.Quote(i.name), iName, i.name)
-				} else {
-					fmt.Printf("%s: %s.%s, // %s\n", strconv.Quote(i.name), iName, i.name, i.full)
-				}
-			} else if i.kind == TYPE {
-				fmt.Printf("%s: TypeOf((*%s.%s)(nil)).Elem(),\n", strconv.Quote("\x00"+i.name), iName, i.name)
-			} else {
-				fmt.Printf("%s: %s.%s,\n", strconv.Quote(i.name), iName, i.name)
-			}
+		if items := scanPackage(pkg); len(items) > 0 {
+			fmt.Fprintf(os.Stderr, " %s", pkg.Path())
+			pkgs = append(pkgs, scanned{pkg.Path(), items})
 		}
-		fmt.Printf("},\n")
 	}
-	fmt.Println("}")
 	fmt.Fprintln(os.Stderr)
+	sort.Slice(pkgs, func(i, j int) bool { return pkgs[i].path < pkgs[j].path })
+
+	if *dir != "" {
+		if err := os.MkdirAll(*dir, 0777); err != nil {
+			fail(err)
+		}
+		for _, p := range pkgs {
+			tag := escapeTag(p.path)
+			constraint := fmt.Sprintf("(!kakapo_nostd || kakapo_%s) && !kakapo_no_%s",
+				tag, tag)
+			file := filepath.Join(*dir, tag+".go")
+			if err := os.WriteFile(file, generate([]scanned{p}, constraint), 0666); err != nil {
+				fail(err)
+			}
+		}
+		return
+	}
+	src := generate(pkgs, "")
+	if *output == "" {
+		_, err = os.Stdout.Write(src)
+	} else {
+		err = os.WriteFile(*output, src, 0666)
+	}
+	if err != nil {
+		fail(err)
+	}
 }
 
-func isInt(s string) bool {
-    r := regexp.MustCompile(".* = ")
-    s = r.ReplaceAllString(s, "")
-    _, err := strconv.ParseInt(s, 10, 64)
-    if err != nil {
-        _, err := strconv.ParseInt(s, 0, 64)
-        if err == nil {
-            return true
-        }
-        return false
-    }
-    return true
-}
-
-func isUint(s string) bool {
-    r := regexp.MustCompile(".* = ")
-    s = r.ReplaceAllString(s, "")
-    _, err := strconv.ParseUint(s, 10, 64)
-    if err != nil {
-        _, err := strconv.ParseUint(s, 0, 64)
-        if err == nil {
-            return true
-        }
-        return false
-    }
-    return true
-}
-
-var isPkg = regexp.MustCompile("\\.a$")
-
-func readPackages(p string, d string, pkgs map[string][]item) {
-	ents, err := ioutil.ReadDir(path.Join(d, p))
+func fail(err error) {
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
+
+// A scanned package and the identifiers to bind from it.
+type scanned struct {
+	path  string
+	items []item
+}
+
+// generate returns a file that registers pkgs with lisp.RegisterPackage,
+// built under the given constraint along with the tags given with -tags.
+func generate(pkgs []scanned, constraint string) []byte {
+	var b bytes.Buffer
+	fmt.Fprintln(&b, "// Code generated by scanpkgs. DO NOT EDIT.")
+	fmt.Fprintln(&b)
+	exprs := tags
+	if constraint != "" {
+		exprs = append(exprs[:len(exprs):len(exprs)], constraint)
+	}
+	if len(exprs) > 0 {
+		fmt.Fprintf(&b, "//go:build %s\n\n", strings.Join(exprs, " && "))
+	}
+	fmt.Fprintf(&b, "package %s\n\n", *pkgName)
+	fmt.Fprintln(&b, "import (")
+	if hasTypes(pkgs) {
+		fmt.Fprintln(&b, `"reflect"`)
+	}
+	fmt.Fprintln(&b, `"github.com/chrissexton/kakapo/lisp"`)
+	for _, p := range pkgs {
+		fmt.Fprintf(&b, "\t%s %s\n", escapePkgName(p.path), strconv.Quote(p.path))
+	}
+	fmt.Fprintln(&b, ")")
+
+	fmt.Fprintln(&b, "func init() {")
+	for _, p := range pkgs {
+		fmt.Fprintf(&b, "lisp.RegisterPackage(%s, func() map[string]interface{} {\n",
+			strconv.Quote(p.path))
+		fmt.Fprint(&b, "return ")
+		writeTable(&b, p)
+		fmt.Fprintln(&b, "\n})")
+	}
+	fmt.Fprintln(&b, "}")
+
+	src, err := format.Source(b.Bytes())
 	if err != nil {
-		return
+		fail(err)
 	}
-	for _, ent := range ents {
-		n := ent.Name()
-		if ent.IsDir() {
-			readPackages(path.Join(p, n), d, pkgs)
-			continue
+	return src
+}
+
+func hasTypes(pkgs []scanned) bool {
+	for _, p := range pkgs {
+		for _, i := range p.items {
+			if i.kind == TYPE {
+				return true
+			}
 		}
-		pn := path.Join(p, n[0:len(n)-2])
-		if isPkg.MatchString(n) && !ignored(pn) {
-			pkgs[pn] = make([]item, 0)
-			fmt.Fprintf(os.Stderr, " %s", path.Join(p, n[0:len(n)-2]))
-			readPackage(p, d, n, pkgs)
+	}
+	return false
+}
+
+// writeTable writes the map of the identifiers of p for kakapo's import.
+// Types are stored under their name prefixed with a NUL byte.
+func writeTable(w *bytes.Buffer, p scanned) {
+	iName := escapePkgName(p.path)
+	fmt.Fprintln(w, "map[string]interface{} {")
+	for _, i := range p.items {
+		switch i.kind {
+		case CONST:
+			fmt.Fprintf(w, "%s: %s,\n", strconv.Quote(i.name), i.expr)
+		case TYPE:
+			fmt.Fprintf(w, "%s: reflect.TypeOf((*%s.%s)(nil)).Elem(),\n",
+				strconv.Quote("\x00"+i.name), iName, i.name)
+		default:
+			fmt.Fprintf(w, "%s: %s.%s,\n", strconv.Quote(i.name), iName, i.name)
 		}
 	}
+	fmt.Fprint(w, "}")
+}
+
+// stdPackages returns the import paths of the packages in GOROOT that can be
+// built for the current platform, in order.
+func stdPackages() []string {
+	src := filepath.Join(runtime.GOROOT(), "src")
+	var names []string
+	filepath.WalkDir(src, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		switch n := d.Name(); {
+		case n == "testdata", n == "vendor", n == "internal",
+			strings.HasPrefix(n, "_"), strings.HasPrefix(n, "."):
+			return filepath.SkipDir
+		}
+		if p == src {
+			return nil
+		}
+		name := filepath.ToSlash(p[len(src)+1:])
+		if ignored(name) {
+			return filepath.SkipDir
+		}
+		pkg, err := build.Default.ImportDir(p, 0)
+		if err != nil || pkg.Name == "main" {
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	})
+	return names
 }
 
 func ignored(name string) bool {
 	for _, n := range ignorePkgs {
-		if strings.HasPrefix(name, n) {
+		if name == strings.TrimSuffix(n, "/") || strings.HasPrefix(name, n) {
 			return true
 		}
 	}
 	return false
 }
 
-var gopath string
-func readPackage(p, d, n string, pkgs map[string][]item) {
-	i := path.Join(p, n[0:len(n)-2])
-	// TODO do this /without/ shelling out to AR(1)
-	fname := path.Join(d, p, n)
-	cmd := exec.Command(gopath, "tool", "pack", "x", fname, "__.PKGDEF")
-	err := cmd.Run()
-	if err != nil {
-		panic(err)
-	}
-
-	// read all lines from __.PKGDEF
-	bs, err := ioutil.ReadFile("__.PKGDEF")
-	if err != nil {
-		panic(err)
-	}
-	lines := strings.Split(string(bs),"\n")
-	for _, line := range lines {
-		l := strings.TrimSpace(line)
-		if !importable.MatchString(l) {
+// scanPackage returns the exported identifiers of pkg that can be bound, in
+// order.
+func scanPackage(pkg *types.Package) []item {
+	var items []item
+	scope := pkg.Scope()
+	for _, name := range scope.Names() {
+		obj := scope.Lookup(name)
+		if !obj.Exported() {
 			continue
 		}
-		it := item{}
-		if fM.MatchString(l) {
-			it.kind = FUNC
-		} else if cM.MatchString(l) {
-			it.kind = CONST
-		} else if vM.MatchString(l) {
-			it.kind = VAR
-		} else if tM.MatchString(l) {
-			it.kind = TYPE
-		}
-		it.full = l
-		l = importable.ReplaceAllString(l, "")
-		it.name = first.ReplaceAllString(l, "")
-		if unicode.IsUpper(getFirst(it.name)) {
-			pkgs[i] = append(pkgs[i], it)
+		switch obj := obj.(type) {
+		case *types.Func:
+			sig := obj.Type().(*types.Signature)
+			if sig.TypeParams().Len() > 0 {
+				// generic functions must be instantiated to be used
+				continue
+			}
+			items = append(items, item{kind: FUNC, name: name})
+		case *types.Var:
+			if containsLock(obj.Type()) {
+				// a copy of a lock is of no use
+				continue
+			}
+			items = append(items, item{kind: VAR, name: name})
+		case *types.Const:
+			if expr, ok := constExpr(pkg, obj); ok {
+				items = append(items, item{kind: CONST, name: name, expr: expr})
+			}
+		case *types.TypeName:
+			if named, ok := obj.Type().(*types.Named); ok &&
+				named.TypeParams().Len() > 0 {
+				continue
+			}
+			if alias, ok := obj.Type().(*types.Alias); ok &&
+				alias.TypeParams().Len() > 0 {
+				continue
+			}
+			if iface, ok := obj.Type().Underlying().(*types.Interface); ok &&
+				!iface.IsMethodSet() {
+				// constraints are not types of values
+				continue
+			}
+			items = append(items, item{kind: TYPE, name: name})
 		}
 	}
-	os.Remove("__.PKGDEF")
+	return items
 }
 
-func findGo() {
-	var err error
-	gopath, err = exec.LookPath("go")
-	if err != nil {
-		panic(err)
+// containsLock reports whether values of type t hold a lock, such as a
+// sync.Mutex, that must not be copied.
+func containsLock(t types.Type) bool {
+	if _, ok := t.Underlying().(*types.Interface); ok {
+		return false
+	}
+	if !isLock(t) && isLock(types.NewPointer(t)) {
+		return true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if containsLock(u.Field(i).Type()) {
+				return true
+			}
+		}
+	case *types.Array:
+		return containsLock(u.Elem())
 	}
+	return false
 }
 
-func getFirst(s string) rune {
-	r, _, err := strings.NewReader(s).ReadRune()
-	if err != nil {
-		panic(err)
+func isLock(t types.Type) bool {
+	ms := types.NewMethodSet(t)
+	return ms.Lookup(nil, "Lock") != nil && ms.Lookup(nil, "Unlock") != nil
+}
+
+// constExpr returns the Go expression used for the constant c. Typed
+// constants are used as they are. Untyped ones are given the type kakapo
+// converts them to, and are left out if they do not fit it.
+func constExpr(pkg *types.Package, c *types.Const) (string, bool) {
+	ref := escapePkgName(pkg.Path()) + "." + c.Name()
+	basic, ok := c.Type().(*types.Basic)
+	if !ok || basic.Info()&types.IsUntyped == 0 {
+		return ref, true
+	}
+	v := c.Val()
+	switch v.Kind() {
+	case constant.Int:
+		if _, ok := constant.Int64Val(v); ok {
+			return "int64(" + ref + ")", true
+		}
+		if _, ok := constant.Uint64Val(v); ok {
+			return "uint64(" + ref + ")", true
+		}
+		return "", false
+	case constant.Float:
+		if f, _ := constant.Float64Val(v); math.IsInf(f, 0) {
+			return "", false
+		}
+		return "float64(" + ref + ")", true
+	case constant.Complex:
+		return "complex128(" + ref + ")", true
 	}
-	return r
+	return ref, true
 }
 
 func escapePkgName(name string) string {
-	return "i_" + strings.Map(func(r rune) rune {
+	return "i_" + escapeTag(name)
+}
+
+// escapeTag returns the import path name in the form used in build tags and
+// file names.
+func escapeTag(name string) string {
+	return strings.Map(func(r rune) rune {
 		if strings.ContainsRune("-_./", r) {
 			return '_'
 		}
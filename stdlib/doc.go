@@ -0,0 +1,13 @@
+// Package stdlib makes the Go standard library importable from kakapo.
+//
+// The bindings are generated into this directory by configure, one file per
+// package. Each registers its package with lisp.RegisterPackage when the
+// program starts, and the package is only loaded once it is imported.
+//
+// The packages compiled in are chosen with build tags. kakapo_no_<pkg> leaves
+// a package out, and kakapo_nostd leaves out every package except those named
+// with kakapo_<pkg>, where <pkg> is the import path with "/", "." and "-"
+// replaced by "_":
+//
+//	go install -tags kakapo_nostd,kakapo_fmt,kakapo_strings
+package stdlib
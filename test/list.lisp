@@ -14,3 +14,16 @@
 (T' (equal? '(1) (map identity '(1))))
 (T' (equal? '(1 2) (map identity '(1 2))))
 
+
+(S' "Maps")
+(T' (map? {}))
+(T' (= (map-get {"a" 1} "a") 1))
+(T' (let ((m (make-map)))
+      (begin
+        (map-set! m 'k 'v)
+        (equal? m '{k v}))))
+
+(S' "Vectors")
+(T' (vector? [1 2]))
+(T' (= (vector-ref [1 2] 1) 2))
+(T' (= (vector-length (vector-append [1] [2 3])) 3))
@@ -15,3 +15,21 @@
 (S' "Macros 5")
 (T' (= nil (or2 nil nil)))
 
+
+(defmacro sq-twice (x) (list 'square (list 'square x)))
+(S' "Macros 6")
+(T' (equal? '(* (square 2) (square 2))
+            (macroexpand '(sq-twice 2))))
+(S' "Macros 7")
+(T' (equal? '(list (quote (square 1)) (* (* 2 2) (* 2 2)))
+            (macroexpand-all '(list '(square 1) (sq-twice 2)))))
+
+(defmacro my-when (c &body body) (list 'if c (cons 'begin body) nil))
+(S' "Macros 8")
+(T' (= 2 (my-when true 1 2)))
+
+(defmacro add (x &optional (y 10) &key (times 1)) (list '* times (list '+ x y)))
+(S' "Macros 9")
+(T' (= 11 (add 1)))
+(S' "Macros 10")
+(T' (= 6 (add 1 2 :times 2)))
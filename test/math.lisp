@@ -45,3 +45,31 @@
 (T' (= -1 (- 1)))
 (T' (= -1 (- 1 2)))
 
+
+(S' "Multiplication and division")
+(T' (= (* 2 3 4) 24))
+(T' (= (/ 8 2) 4))
+(T' (= (/ 1 3) 1/3))
+(T' (= (/ 2) 1/2))
+(T' (= (* 3 (/ 1 3)) 1))
+
+(S' "Remainder")
+(T' (= (% 7 3) 1))
+(T' (= (% -7 3) -1))
+(T' (= (% 7.5 2) 1.5))
+
+(S' "Exact integers")
+(T' (= (* 4294967296 4294967296) 18446744073709551616))
+(T' (= (- (+ 9223372036854775807 1) 1) 9223372036854775807))
+(T' (< 9223372036854775807 9223372036854775808))
+
+(S' "Contagion")
+(T' (= (+ 1 0.5) 1.5))
+(T' (= (+ 1/2 0.5) 1))
+(T' (= 1 1.0))
+(T' (< 1/3 0.34))
+
+(S' "Complex numbers")
+(T' (= (+ 1+2i 3-2i) 4))
+(T' (= (* 1i 1i) -1))
+(F' (= 1+2i 1-2i))
@@ -0,0 +1,11 @@
+; Modules
+
+(S' "require")
+
+(require "modules/sets")
+(T' (sets.member? 2 '(1 2 3)))
+(F' (sets.member? 4 '(1 2 3)))
+(T' (equal? (sets.adjoin 1 '(1 2)) '(1 2)))
+
+(require "modules/sets" :as s)
+(T' (equal? (s.adjoin 3 '(1 2)) '(3 1 2)))
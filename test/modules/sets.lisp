@@ -0,0 +1,13 @@
+; A module for test/modules.lisp
+
+(provide member? adjoin)
+
+(define member?
+  (lambda (x xs)
+    (if xs
+      (if (equal? x (car xs)) true (member? x (cdr xs)))
+      false)))
+
+(define adjoin
+  (lambda (x xs)
+    (if (member? x xs) xs (cons x xs))))
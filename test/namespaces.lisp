@@ -0,0 +1,19 @@
+; Namespaces
+
+(S' "namespaces")
+
+(define len 'shadowed)
+(T' (equal? len 'shadowed))
+(T' (= (core/len '(1 2)) 2))
+(T' (equal? (map (lambda (x) (+ x 1)) '(1 2)) '(2 3)))
+
+(in-ns 'geometry)
+(define square (lambda (x) (* x x)))
+(user/T' (= (square 3) 9))
+(in-ns 'user)
+
+(T' (= (geometry/square 4) 16))
+(T' (equal? (current-ns) 'user))
+(T' (= (map-count (ns-publics 'geometry)) 1))
+(T' (ns-resolve 'geometry 'square))
+(F' (ns-resolve 'geometry 'cube))
@@ -0,0 +1,12 @@
+; Quasiquotation
+
+(S' "quasiquote")
+
+(define xs '(2 3))
+(T' (equal? `(1 ,(car xs)) '(1 2)))
+(T' (equal? `(1 ,@xs 4) '(1 2 3 4)))
+(T' (equal? `(1 `(2 ,(3 ,(car xs)))) '(1 `(2 ,(3 2)))))
+
+(defmacro unless (c body) `(if ,c nil ,body))
+(T' (= (unless nil 1) 1))
+(T' (equal? (unless true 1) nil))